@@ -0,0 +1,39 @@
+package pathways
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AccessLog records every request handled by the service to logger.
+//
+// eg. service.AccessLog(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+func (s *Service) AccessLog(logger *slog.Logger) *Service {
+	s.accessLog = logger
+	return s
+}
+
+// JSONAccessLog records every request handled by the service to w as JSON
+// lines.
+func (s *Service) JSONAccessLog(w io.Writer) *Service {
+	return s.AccessLog(slog.New(slog.NewJSONHandler(w, nil)))
+}
+
+func (s *Service) logAccess(route *Route, w *statusWriter, request *http.Request, duration time.Duration) {
+	name := ""
+	if route != nil {
+		name = route.name
+	}
+	s.accessLog.LogAttrs(request.Context(), slog.LevelInfo, "access",
+		slog.String("method", request.Method),
+		slog.String("path", request.URL.Path),
+		slog.String("route", name),
+		slog.Int("status", w.Status()),
+		slog.Int64("bytes", w.bytes),
+		slog.Duration("duration", duration),
+		slog.String("remote_addr", request.RemoteAddr),
+		slog.String("request_id", RequestID(request)),
+	)
+}
@@ -0,0 +1,58 @@
+package pathways
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONAccessLog(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := NewService("/api").JSONAccessLog(logs)
+	s.Path("/items/{id}").Name("Get").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusCreated, "created")
+	})
+	req := httptest.NewRequest("GET", "/api/items/1", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(requestIDHeader, "abc")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/missing", nil))
+
+	lines := bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 access log lines but got %q", logs.String())
+	}
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"msg":         "access",
+		"method":      "GET",
+		"path":        "/api/items/1",
+		"route":       "Get",
+		"status":      201.0,
+		"bytes":       float64(w.Body.Len()),
+		"remote_addr": "10.0.0.1:1234",
+		"request_id":  "abc",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("expected %s to be %#v but got %#v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["duration"]; !ok {
+		t.Errorf("expected a duration in %s", lines[0])
+	}
+
+	entry = map[string]interface{}{}
+	if err := json.Unmarshal(lines[1], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["route"] != "" || entry["status"] != 404.0 {
+		t.Errorf("unexpected entry for an unmatched request %s", lines[1])
+	}
+}
@@ -1,18 +1,22 @@
 package pathways
 
 import (
+	"encoding"
 	"errors"
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type RouteAction func(context *Context) *Response
 
 func (r RouteAction) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	r(&Context{
-		Request:  request,
-		Response: writer,
+		Request:   request,
+		Response:  writer,
+		RequestID: RequestID(request),
 	}).Write()
 }
 
@@ -35,6 +39,9 @@ func applyAPIFunction(f interface{}, requestTemplateType interface{}) RouteActio
 	if requestType != nil && requestType.Kind() != reflect.Ptr {
 		panic("request structure must be a pointer")
 	}
+	if requestType != nil {
+		mustCompileRules(requestType)
+	}
 
 	function := reflect.ValueOf(f)
 	if function.Kind() != reflect.Func || !function.IsValid() {
@@ -48,11 +55,15 @@ func applyAPIFunction(f interface{}, requestTemplateType interface{}) RouteActio
 		}
 		if requestTemplateType != nil {
 			v := reflect.New(requestType.Elem())
-			ct := cx.InferContentType("application/json")
-			err := Serializers.DecodeRequest(cx.Request, ct, v.Interface())
-			if err != nil {
+			if response := decodeBody(cx, v.Interface()); response != nil {
+				return response
+			}
+			if err := bindRequest(cx, v); err != nil {
 				return cx.APIError(http.StatusBadRequest, err.Error())
 			}
+			if err := Validate(v.Interface()); err != nil {
+				return cx.ValidationError(err)
+			}
 			in = append(in, v)
 		}
 		response := function.Call(in)
@@ -60,6 +71,39 @@ func applyAPIFunction(f interface{}, requestTemplateType interface{}) RouteActio
 	}
 }
 
+// Decode the request body, if any, into v. Returns an error response on
+// failure.
+func decodeBody(cx *Context, v interface{}) *Response {
+	isPatchRoute := cx.route != nil && cx.route.patch
+	if !hasBody(cx.Request) {
+		if isPatchRoute {
+			return unsupportedPatch(cx, cx.RequestContentType(""))
+		}
+		return nil
+	}
+	ct := cx.RequestContentType("application/json")
+	var response *Response
+	var err error
+	switch {
+	case isPatchContentType(ct):
+		response = decodePatch(cx, ct, v)
+	case isPatchRoute:
+		// Decoding a partial document in full would reset omitted fields.
+		return unsupportedPatch(cx, ct)
+	case cx.strict:
+		err = cx.Serializers().DecodeRequestStrict(cx.Request, ct, v)
+	default:
+		err = cx.Serializers().DecodeRequest(cx.Request, ct, v)
+	}
+	if cx.bodyTooLarge() {
+		return cx.APIError(http.StatusRequestEntityTooLarge, ErrBodyTooLarge.Error())
+	}
+	if err != nil {
+		return cx.APIError(http.StatusBadRequest, err.Error())
+	}
+	return response
+}
+
 func applyFunction(f interface{}) RouteAction {
 	function := reflect.ValueOf(f)
 	if function.Kind() != reflect.Func || !function.IsValid() {
@@ -75,43 +119,61 @@ func applyFunction(f interface{}) RouteAction {
 	}
 }
 
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Coerce a string into a value of type t. Slices are parsed from comma
+// separated values and durations with time.ParseDuration. Types implementing
+// encoding.TextUnmarshaler, such as time.Time, are also supported.
 func coerce(s string, t reflect.Type) (reflect.Value, error) {
-	switch t.Kind() {
-	case reflect.Int:
-		v, err := strconv.ParseInt(s, 10, 64)
-		return reflect.ValueOf(int(v)), err
-	case reflect.Int8:
-		v, err := strconv.ParseInt(s, 10, 8)
-		return reflect.ValueOf(int8(v)), err
-	case reflect.Uint8:
-		v, err := strconv.ParseUint(s, 10, 8)
-		return reflect.ValueOf(uint8(v)), err
-	case reflect.Int16:
-		v, err := strconv.ParseInt(s, 10, 16)
-		return reflect.ValueOf(int16(v)), err
-	case reflect.Uint16:
-		v, err := strconv.ParseUint(s, 10, 16)
-		return reflect.ValueOf(uint16(v)), err
-	case reflect.Int32:
-		v, err := strconv.ParseInt(s, 10, 32)
-		return reflect.ValueOf(int32(v)), err
-	case reflect.Uint32:
-		v, err := strconv.ParseUint(s, 10, 32)
-		return reflect.ValueOf(uint32(v)), err
-	case reflect.Int64:
-		v, err := strconv.ParseInt(s, 10, 64)
-		return reflect.ValueOf(int64(v)), err
-	case reflect.Uint64:
-		v, err := strconv.ParseUint(s, 10, 64)
-		return reflect.ValueOf(uint64(v)), err
-	case reflect.Float32:
-		v, err := strconv.ParseFloat(s, 32)
-		return reflect.ValueOf(float32(v)), err
-	case reflect.Float64:
-		v, err := strconv.ParseFloat(s, 64)
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		v := reflect.New(t)
+		err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		return v.Elem(), err
+	}
+	switch t {
+	case durationType:
+		v, err := time.ParseDuration(s)
 		return reflect.ValueOf(v), err
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		return reflect.ValueOf(v).Convert(t), err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, t.Bits())
+		return reflect.ValueOf(v).Convert(t), err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, t.Bits())
+		return reflect.ValueOf(v).Convert(t), err
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, t.Bits())
+		return reflect.ValueOf(v).Convert(t), err
 	case reflect.String:
-		return reflect.ValueOf(s), nil
+		return reflect.ValueOf(s).Convert(t), nil
+	case reflect.Ptr:
+		v, err := coerce(s, t.Elem())
+		if err != nil {
+			return v, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(v)
+		return p, nil
+	case reflect.Slice:
+		out := reflect.MakeSlice(t, 0, 0)
+		if s == "" {
+			return out, nil
+		}
+		for _, part := range strings.Split(s, ",") {
+			v, err := coerce(part, t.Elem())
+			if err != nil {
+				return out, err
+			}
+			out = reflect.Append(out, v)
+		}
+		return out, nil
 	}
 	return reflect.ValueOf(s), errors.New("unsupported argument type " + t.String())
 }
@@ -0,0 +1,114 @@
+package pathways
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Sources of request values that can be bound to struct fields, and the
+// struct tag used to name them.
+var bindingTags = []string{"path", "query", "header"}
+
+// Returns true if the request may have a body to decode.
+func hasBody(request *http.Request) bool {
+	return request.Body != nil && request.Body != http.NoBody && request.ContentLength != 0
+}
+
+// Populate fields of the request struct v tagged with `path:"name"`,
+// `query:"name"` or `header:"Name"` from the corresponding part of the
+// request. Values are converted with coerce. Missing values leave the field
+// untouched, so values bound from the request override those decoded from
+// the body.
+func bindRequest(cx *Context, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	query := cx.Request.URL.Query()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			// Exported fields of embedded structs are promoted, as with
+			// encoding/json, even if the struct type is unexported.
+			if err := bindRequest(cx, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous {
+			if err := bindRequest(cx, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, source := range bindingTags {
+			name := strings.Split(field.Tag.Get(source), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			var values []string
+			switch source {
+			case "path":
+				if value, ok := pathVar(cx.PathVars, name); ok {
+					values = []string{value}
+				}
+			case "query":
+				values = query[name]
+			case "header":
+				values = cx.Request.Header.Values(name)
+			}
+			if len(values) == 0 {
+				continue
+			}
+			if err := bindValues(v.Field(i), values); err != nil {
+				return fmt.Errorf("invalid %s parameter %q: %s", source, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Look up a path variable, including remainder variables of the form
+// {name...}.
+func pathVar(vars map[string]string, name string) (string, bool) {
+	if value, ok := vars[name]; ok {
+		return value, ok
+	}
+	value, ok := vars[name+"..."]
+	return value, ok
+}
+
+// Set a field from one or more values. Multiple values are only permitted
+// for slices, which accumulate each value.
+func bindValues(field reflect.Value, values []string) error {
+	t := field.Type()
+	if t.Kind() == reflect.Slice && !reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		out := reflect.MakeSlice(t, 0, len(values))
+		for _, value := range values {
+			v, err := coerce(value, t)
+			if err != nil {
+				return err
+			}
+			out = reflect.AppendSlice(out, v)
+		}
+		field.Set(out)
+		return nil
+	}
+	v, err := coerce(values[0], t)
+	if err != nil {
+		return err
+	}
+	field.Set(v)
+	return nil
+}
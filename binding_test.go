@@ -0,0 +1,170 @@
+package pathways
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindingLevel int
+
+func (l bindingLevel) MarshalText() ([]byte, error) {
+	return []byte([]string{"", "low", "high"}[l]), nil
+}
+
+func (l *bindingLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	case "":
+		*l = 0
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+type bindingPage struct {
+	Limit int `query:"limit"`
+}
+
+type boundRequest struct {
+	bindingPage
+	Key     string        `path:"key"`
+	IDs     []uint        `query:"id"`
+	Tenant  string        `header:"X-Tenant"`
+	Verbose bool          `query:"verbose"`
+	Timeout time.Duration `query:"timeout"`
+	Since   *time.Time    `query:"since"`
+	Level   bindingLevel  `query:"level"`
+	Name    string        `query:"name"`
+}
+
+func boundService(root string) *Service {
+	s := NewService(root)
+	s.Path("/bound/{key}").Name("Bound").Post().APIRequestType(&boundRequest{}).APIFunction(func(cx *Context, req *boundRequest) *Response {
+		return cx.APIResponse(http.StatusOK, req)
+	})
+	return s
+}
+
+func bindForTest(t *testing.T, s *Service, target, body string, header http.Header) (*httptest.ResponseRecorder, *boundRequest) {
+	t.Helper()
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	bound := &boundRequest{}
+	if w.Code == http.StatusOK {
+		if err := Serializers.Decode("application/json", w.Body, bound); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, bound
+}
+
+func TestBindRequest(t *testing.T) {
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	w, bound := bindForTest(t, boundService("/api"),
+		"/api/bound/foo?limit=5&id=1,2&id=3&verbose=true&timeout=1m30s&since=2020-01-02T03:04:05Z&level=high",
+		`{"Name":"body"}`, http.Header{"X-Tenant": {"acme"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 but got %d: %s", w.Code, w.Body.String())
+	}
+	expected := &boundRequest{
+		bindingPage: bindingPage{Limit: 5},
+		Key:         "foo",
+		IDs:         []uint{1, 2, 3},
+		Tenant:      "acme",
+		Verbose:     true,
+		Timeout:     90 * time.Second,
+		Since:       &since,
+		Level:       2,
+		Name:        "body",
+	}
+	if !reflect.DeepEqual(bound, expected) {
+		t.Errorf("expected %+v but got %+v", expected, bound)
+	}
+}
+
+func TestBindRequestOverridesBody(t *testing.T) {
+	_, bound := bindForTest(t, boundService("/api"), "/api/bound/foo?name=query", `{"Name":"body","Tenant":"body"}`, nil)
+	if bound.Name != "query" || bound.Tenant != "body" {
+		t.Errorf("expected bound values to override only those present but got %+v", bound)
+	}
+}
+
+func TestBindRequestInvalidValues(t *testing.T) {
+	tests := []struct {
+		target string
+		header http.Header
+		err    string
+	}{
+		{"/api/bound/foo?limit=x", nil, `invalid query parameter \"limit\"`},
+		{"/api/bound/foo?id=1,-2", nil, `invalid query parameter \"id\"`},
+		{"/api/bound/foo?verbose=maybe", nil, `invalid query parameter \"verbose\"`},
+		{"/api/bound/foo?timeout=soon", nil, `invalid query parameter \"timeout\"`},
+		{"/api/bound/foo?since=yesterday", nil, `invalid query parameter \"since\"`},
+		{"/api/bound/foo?level=medium", nil, `invalid query parameter \"level\": unknown level`},
+	}
+	for _, test := range tests {
+		w, _ := bindForTest(t, boundService("/api"), test.target, "", test.header)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), test.err) {
+			t.Errorf("%s: expected 400 %s but got %d: %s", test.target, test.err, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPathVariablesAreUnescaped(t *testing.T) {
+	s := boundService("/api")
+	s.Path("/files/{path...}").Name("File").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, cx.PathVars["path..."])
+	})
+	_, bound := bindForTest(t, s, "/api/bound/a%2Fb%20c", "", nil)
+	if bound.Key != "a/b c" {
+		t.Errorf("expected an escaped slash to be part of the variable but got %q", bound.Key)
+	}
+	w, _ := bindForTest(t, s, "/api/bound/a/b", "", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected an unescaped slash to separate segments but got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/api/files/a/b%2Fc", nil))
+	if body := w.Body.String(); body != "\"a/b/c\"\n" {
+		t.Errorf("unexpected remainder variable %s", body)
+	}
+}
+
+func TestReverseEscapesPathVariables(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/bound/{key}").Name("Bound").Get()
+	s.Path("/files/{path...}").Name("File").Get()
+	if path := s.Find("Bound").Reverse(map[string]string{"key": "a/b c"}); path != "/api/bound/a%2Fb%20c" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if path := s.Find("File").Reverse(map[string]string{"path...": "a/b c"}); path != "/api/files/a/b%20c" {
+		t.Errorf("unexpected path %q", path)
+	}
+}
+
+func TestClientPathVariableRoundTrip(t *testing.T) {
+	server := httptest.NewServer(boundService("/api"))
+	defer server.Close()
+	client := NewClient(boundService(server.URL+"/api"), "application/json")
+	bound := &boundRequest{}
+	if _, err := client.Call("Bound", Args{"key": "a/b?c"}, &boundRequest{}, bound); err != nil {
+		t.Fatal(err)
+	}
+	if bound.Key != "a/b?c" {
+		t.Errorf("expected the key to round trip but got %q", bound.Key)
+	}
+}
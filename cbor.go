@@ -0,0 +1,86 @@
+package pathways
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBORSerializer encodes and decodes RFC 8949 CBOR. 64-bit integers are
+// represented exactly, and when decoding into an interface{} unsigned and
+// negative integers are decoded as uint64 and int64 respectively.
+type CBORSerializer struct {
+	// Use Core Deterministic Encoding (RFC 8949 section 4.2.1), so that equal
+	// values always encode to identical bytes. Suitable for signing.
+	Deterministic bool
+
+	once   sync.Once
+	enc    cbor.EncMode
+	dec    cbor.DecMode
+	strict cbor.DecMode
+}
+
+func (c *CBORSerializer) modes() (cbor.EncMode, cbor.DecMode) {
+	c.once.Do(func() {
+		encOptions := cbor.EncOptions{}
+		if c.Deterministic {
+			encOptions = cbor.CoreDetEncOptions()
+		}
+		var err error
+		c.enc, err = encOptions.EncMode()
+		if err != nil {
+			panic(err)
+		}
+		decOptions := cbor.DecOptions{
+			DefaultMapType: reflect.TypeOf(map[string]interface{}{}),
+			IntDec:         cbor.IntDecConvertNone,
+		}
+		c.dec, err = decOptions.DecMode()
+		if err != nil {
+			panic(err)
+		}
+		decOptions.ExtraReturnErrors = cbor.ExtraDecErrorUnknownField
+		c.strict, err = decOptions.DecMode()
+		if err != nil {
+			panic(err)
+		}
+	})
+	return c.enc, c.dec
+}
+
+func (c *CBORSerializer) NewEncoder(w io.Writer) ContentTypeEncoder {
+	enc, _ := c.modes()
+	return enc.NewEncoder(w)
+}
+
+func (c *CBORSerializer) NewDecoder(r io.Reader) ContentTypeDecoder {
+	_, dec := c.modes()
+	return dec.NewDecoder(r)
+}
+
+// NewStrictDecoder returns a CBOR decoder that rejects map keys not present
+// in the target struct, and trailing data.
+func (c *CBORSerializer) NewStrictDecoder(r io.Reader) ContentTypeDecoder {
+	c.modes()
+	return &strictCBORDecoder{r: r, dec: c.strict}
+}
+
+type strictCBORDecoder struct {
+	r   io.Reader
+	dec cbor.DecMode
+}
+
+func (s *strictCBORDecoder) Decode(v interface{}) error {
+	data, err := ioutil.ReadAll(s.r)
+	if err != nil {
+		return err
+	}
+	err = s.dec.Unmarshal(data, v)
+	if _, ok := err.(*cbor.ExtraneousDataError); ok {
+		return ErrTrailingData
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package pathways
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type cborRecord struct {
+	Name  string            `cbor:"name"`
+	Big   uint64            `cbor:"big"`
+	Small int64             `cbor:"small"`
+	Tags  map[string]string `cbor:"tags"`
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	record := &cborRecord{Name: "a", Big: math.MaxUint64, Small: math.MinInt64, Tags: map[string]string{"x": "1"}}
+	w := &bytes.Buffer{}
+	if err := Serializers.Encode("application/cbor", w, record); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &cborRecord{}
+	if err := Serializers.Decode("application/cbor", w, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, record) {
+		t.Errorf("expected %+v but got %+v", record, decoded)
+	}
+}
+
+func TestCBORIntegersInInterfaces(t *testing.T) {
+	w := &bytes.Buffer{}
+	input := map[string]interface{}{"big": uint64(math.MaxUint64), "small": int64(math.MinInt64), "one": 1}
+	if err := Serializers.Encode("application/cbor", w, input); err != nil {
+		t.Fatal(err)
+	}
+	var decoded interface{}
+	if err := Serializers.Decode("application/cbor", w, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"big": uint64(math.MaxUint64), "small": int64(math.MinInt64), "one": uint64(1)}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected %#v but got %#v", expected, decoded)
+	}
+}
+
+func TestCBORDeterministicEncoding(t *testing.T) {
+	serializer := &CBORSerializer{Deterministic: true}
+	value := map[string]interface{}{}
+	for _, key := range []string{"delta", "a", "charlie", "bb", "echo"} {
+		value[key] = len(key)
+	}
+	first := &bytes.Buffer{}
+	if err := serializer.NewEncoder(first).Encode(value); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		w := &bytes.Buffer{}
+		if err := serializer.NewEncoder(w).Encode(value); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(w.Bytes(), first.Bytes()) {
+			t.Fatalf("expected identical encodings but got %x and %x", first.Bytes(), w.Bytes())
+		}
+	}
+	// Core deterministic encoding sorts keys by their encoded bytes, so
+	// shorter keys come first.
+	a := bytes.Index(first.Bytes(), []byte("a"))
+	bb := bytes.Index(first.Bytes(), []byte("bb"))
+	delta := bytes.Index(first.Bytes(), []byte("delta"))
+	if !(a < bb && bb < delta) {
+		t.Errorf("keys are not in deterministic order: %x", first.Bytes())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // Client request arguments.
@@ -26,9 +27,13 @@ func (c *ClientError) Error() string {
 
 // A HTTP client that uses named routes on a service to reconstruct and send requests.
 type Client struct {
-	service  *Service
-	encoding string
-	Client   *http.Client
+	service     *Service
+	encoding    string
+	parent      *Context
+	cache       ClientCache
+	exporter    SpanExporter
+	serializers *SerializerRegistry
+	Client      *http.Client
 }
 
 // Create a new service client.
@@ -40,11 +45,47 @@ func NewClient(service *Service, encoding string) *Client {
 	}
 }
 
+// WithContext returns a copy of the client that propagates the request ID and
+// trace context of the request being handled by cx to outgoing requests.
+func (c *Client) WithContext(cx *Context) *Client {
+	client := *c
+	client.parent = cx
+	return &client
+}
+
+// Serializers to use for this client, rather than those of the service.
+func (c *Client) Serializers(serializers *SerializerRegistry) *Client {
+	c.serializers = serializers
+	return c
+}
+
+// Registry used by this client. Defaults to the
+// service registry, falling back to the global Serializers.
+func (c *Client) registry() *SerializerRegistry {
+	if c.serializers != nil {
+		return c.serializers
+	}
+	return c.service.serializerRegistry()
+}
+
+// SpanExporter to send client spans to.
+func (c *Client) SpanExporter(exporter SpanExporter) *Client {
+	c.exporter = exporter
+	return c
+}
+
 // Call an API endpoint.
 func (c *Client) Call(name string, args Args, request interface{}, response interface{}) (*http.Response, error) {
+	return c.CallIfMatch(name, args, "", request, response)
+}
+
+// CallIfMatch calls an API endpoint with an If-Match header, if etag is not
+// empty. If the resource no longer matches etag, a *PreconditionFailedError
+// is returned.
+func (c *Client) CallIfMatch(name string, args Args, etag string, request interface{}, response interface{}) (*http.Response, error) {
 	// Encode the body
 	bodyw := &bytes.Buffer{}
-	err := Serializers.Encode(c.encoding, bodyw, request)
+	err := c.registry().Encode(c.encoding, bodyw, request)
 	if err != nil {
 		return nil, err
 	}
@@ -55,25 +96,57 @@ func (c *Client) Call(name string, args Args, request interface{}, response inte
 		return nil, err
 	}
 
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	return c.send(name, req, response)
+}
+
+// Send a request for the named route and decode the response.
+func (c *Client) send(name string, req *http.Request, response interface{}) (*http.Response, error) {
+	req.Header.Set("Accept-Encoding", strings.Join(Compressors.Codings(), ", "))
+	cacheKey, cached := c.revalidate(req)
+
+	span := c.startSpan(name, req)
 	resp, err := c.Client.Do(req)
+	c.finishSpan(span, resp, err)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := decompressResponse(resp); err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return resp, c.registry().Decode(c.encoding, bytes.NewReader(cached.Body), response)
+	}
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return resp, &ClientError{
+		clientError := ClientError{
 			status: resp.StatusCode,
 			err:    fmt.Sprintf("HTTP error (%d): %s", resp.StatusCode, resp.Status),
 		}
+		if resp.StatusCode == http.StatusPreconditionFailed {
+			return resp, &PreconditionFailedError{clientError, resp.Header.Get("ETag")}
+		}
+		return resp, &clientError
 	}
 
 	// Decode response
+	if resp.StatusCode == http.StatusNoContent || response == nil {
+		return resp, nil
+	}
 	ct := resp.Header.Get("Content-Type")
 	if !strings.HasPrefix(ct, c.encoding) {
 		return nil, fmt.Errorf("expected %s response from %s, got %s", c.encoding, req.URL, ct)
 	}
-	return resp, Serializers.Decode(c.encoding, resp.Body, response)
+	if cacheKey != "" {
+		if err := c.store(cacheKey, resp); err != nil {
+			return resp, err
+		}
+	}
+	return resp, c.registry().Decode(c.encoding, resp.Body, response)
 }
 
 func (c *Client) MakeRequest(name string, args Args, body []byte) (*http.Request, error) {
@@ -92,5 +165,57 @@ func (c *Client) MakeRequest(name string, args Args, body []byte) (*http.Request
 	}
 	req.Header.Set("Content-Type", c.encoding)
 	req.Header.Set("Accept", c.encoding)
+	if c.parent != nil && c.parent.RequestID != "" {
+		req.Header.Set(requestIDHeader, c.parent.RequestID)
+	}
+	if sc := c.traceContext(); sc.IsValid() {
+		sc.Inject(req.Header)
+	}
 	return req, nil
 }
+
+// Trace context for an outgoing request. This is a child of the parent
+// request, if any, or a new trace if spans are being exported.
+func (c *Client) traceContext() SpanContext {
+	if c.parent != nil && c.parent.Trace.IsValid() {
+		return c.parent.Trace.Child()
+	}
+	if c.exporter != nil {
+		return SpanContext{}.Child()
+	}
+	return SpanContext{}
+}
+
+func (c *Client) startSpan(name string, req *http.Request) *Span {
+	if c.exporter == nil {
+		return nil
+	}
+	sc, err := ExtractSpanContext(req.Header)
+	if err != nil || !sc.Sampled() {
+		return nil
+	}
+	span := &Span{
+		Name:    name,
+		Kind:    SpanKindClient,
+		Context: sc,
+		Start:   time.Now(),
+	}
+	if c.parent != nil {
+		span.Parent = c.parent.Trace
+	}
+	return span
+}
+
+func (c *Client) finishSpan(span *Span, resp *http.Response, err error) {
+	if span == nil {
+		return
+	}
+	span.End = time.Now()
+	if resp != nil {
+		span.Status = resp.StatusCode
+	}
+	if err != nil {
+		span.Error = err.Error()
+	}
+	c.exporter.ExportSpan(span)
+}
@@ -0,0 +1,111 @@
+package pathways
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// A CachedResponse is a response body retained by a ClientCache, along with
+// the validators used to revalidate it.
+type CachedResponse struct {
+	ETag         string
+	LastModified string
+	Body         []byte
+}
+
+// ClientCache stores GET responses so that the Client can revalidate them
+// with If-None-Match and If-Modified-Since, rather than transferring the body
+// again.
+type ClientCache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, response *CachedResponse)
+}
+
+// MemoryCache is an in-memory ClientCache. When full, the oldest entry is
+// evicted.
+type MemoryCache struct {
+	lock       sync.Mutex
+	maxEntries int
+	entries    map[string]*CachedResponse
+	order      []string
+}
+
+// NewMemoryCache creates a cache holding at most maxEntries responses, or an
+// unbounded number if maxEntries is 0.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*CachedResponse{},
+	}
+}
+
+func (m *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	response, ok := m.entries[key]
+	return response, ok
+}
+
+func (m *MemoryCache) Set(key string, response *CachedResponse) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.entries[key]; !ok {
+		m.order = append(m.order, key)
+	}
+	m.entries[key] = response
+	for m.maxEntries > 0 && len(m.order) > m.maxEntries {
+		delete(m.entries, m.order[0])
+		m.order = m.order[1:]
+	}
+}
+
+// Cache GET responses, revalidating them with conditional requests. When a
+// cached response is still valid, Call decodes the cached body and returns
+// the 304 Not Modified response.
+func (c *Client) Cache(cache ClientCache) *Client {
+	c.cache = cache
+	return c
+}
+
+// Add validators from any cached response to a GET request. Returns the
+// cache key, or "" if the request is not cacheable.
+func (c *Client) revalidate(req *http.Request) (string, *CachedResponse) {
+	if c.cache == nil || req.Method != "GET" {
+		return "", nil
+	}
+	key := c.encoding + " " + req.URL.String()
+	cached, ok := c.cache.Get(key)
+	if !ok {
+		return key, nil
+	}
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	return key, cached
+}
+
+// Store a response with validators in the cache, replacing its body with
+// an in-memory copy.
+func (c *Client) store(key string, resp *http.Response) error {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.cache.Set(key, &CachedResponse{
+		ETag:         etag,
+		LastModified: lastModified,
+		Body:         body,
+	})
+	return nil
+}
@@ -0,0 +1,360 @@
+package pathways
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Compressor implements a HTTP content coding, such as gzip.
+type Compressor interface {
+	NewWriter(w io.Writer) io.WriteCloser
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Compressors for each supported content coding. Additional codings, such as
+// zstd or br, can be registered.
+var Compressors = &CompressorRegistry{
+	compressors: map[string]Compressor{
+		"gzip":    &GzipCompressor{},
+		"deflate": &DeflateCompressor{},
+	},
+	preference: []string{"gzip", "deflate"},
+}
+
+// CompressorRegistry maps content codings to Compressors. It is safe for
+// concurrent use.
+type CompressorRegistry struct {
+	lock        sync.RWMutex
+	compressors map[string]Compressor
+	preference  []string
+}
+
+// Register a compressor for a content coding. Codings registered later are
+// preferred over earlier ones when a client accepts both equally.
+func (c *CompressorRegistry) Register(coding string, compressor Compressor) *CompressorRegistry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	coding = strings.ToLower(coding)
+	if _, ok := c.compressors[coding]; !ok {
+		c.preference = append([]string{coding}, c.preference...)
+	}
+	c.compressors[coding] = compressor
+	return c
+}
+
+func (c *CompressorRegistry) Lookup(coding string) (Compressor, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	compressor, ok := c.compressors[strings.ToLower(coding)]
+	return compressor, ok
+}
+
+// Codings returns the registered content codings, most preferred first.
+func (c *CompressorRegistry) Codings() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]string{}, c.preference...)
+}
+
+// Select the most preferred registered coding acceptable to an
+// Accept-Encoding header, or "" if none is.
+func (c *CompressorRegistry) negotiate(acceptEncoding string) string {
+	type coding struct {
+		name string
+		q    float64
+	}
+	accepted := []coding{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted = append(accepted, coding{name, q})
+	}
+	best, bestQ := "", 0.0
+	for _, name := range c.Codings() {
+		q := -1.0
+		for _, a := range accepted {
+			if a.name == name || (a.name == "*" && q < 0) {
+				q = a.q
+			}
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+type GzipCompressor struct {
+	// Compression level, defaults to gzip.DefaultCompression.
+	Level int
+}
+
+func (g *GzipCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	gz, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		panic(err)
+	}
+	return gz
+}
+
+func (g *GzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type DeflateCompressor struct {
+	// Compression level, defaults to zlib.DefaultCompression.
+	Level int
+}
+
+func (d *DeflateCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	level := d.Level
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+	zw, err := zlib.NewWriterLevel(w, level)
+	if err != nil {
+		panic(err)
+	}
+	return zw
+}
+
+// NewReader decodes HTTP "deflate", which is zlib (RFC 1950) wrapped.
+func (d *DeflateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+// Default content types eligible for compression.
+var DefaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-msgpack",
+	"application/bson",
+	"application/cbor",
+	"application/x-protobuf",
+	"application/x-ndjson",
+}
+
+// CompressionOptions control response compression.
+type CompressionOptions struct {
+	// Responses smaller than this are not compressed. Defaults to 1024.
+	MinSize int
+	// Content types eligible for compression. Entries ending in "/*" match
+	// any subtype. Defaults to DefaultCompressibleTypes.
+	ContentTypes []string
+	// Compressors to negotiate from. Defaults to the global Compressors.
+	Compressors *CompressorRegistry
+}
+
+// Compression enables compression of responses negotiated via the
+// Accept-Encoding request header.
+func (s *Service) Compression(options CompressionOptions) *Service {
+	if options.MinSize == 0 {
+		options.MinSize = 1024
+	}
+	if options.ContentTypes == nil {
+		options.ContentTypes = DefaultCompressibleTypes
+	}
+	if options.Compressors == nil {
+		options.Compressors = Compressors
+	}
+	s.compression = &options
+	return s
+}
+
+func (c *CompressionOptions) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+	for _, ct := range c.ContentTypes {
+		if ct == mediaType || (strings.HasSuffix(ct, "/*") && strings.HasPrefix(mediaType, ct[:len(ct)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap the context's response writer with one that compresses the response,
+// if the service enables compression and the client accepts it.
+func (r *Route) compressResponse(cx *Context) *compressWriter {
+	if r.service == nil || r.service.compression == nil || cx.Request.Method == "HEAD" {
+		return nil
+	}
+	options := r.service.compression
+	coding := options.Compressors.negotiate(cx.Request.Header.Get("Accept-Encoding"))
+	if coding == "" {
+		return nil
+	}
+	compressor, _ := options.Compressors.Lookup(coding)
+	w := &compressWriter{
+		ResponseWriter: cx.Response,
+		options:        options,
+		coding:         coding,
+		compressor:     compressor,
+	}
+	cx.Response = w
+	return w
+}
+
+// compressWriter buffers the start of a response until it can decide whether
+// compression is worthwhile.
+type compressWriter struct {
+	http.ResponseWriter
+	options    *CompressionOptions
+	coding     string
+	compressor Compressor
+	status     int
+	buf        bytes.Buffer
+	decided    bool
+	writer     io.WriteCloser // nil if not compressing
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.status != 0 || c.decided {
+		return
+	}
+	c.status = code
+	if length := c.Header().Get("Content-Length"); length != "" {
+		if n, err := strconv.Atoi(length); err == nil && n < c.options.MinSize {
+			c.decide(false)
+		}
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.decided {
+		c.buf.Write(b)
+		if c.buf.Len() >= c.options.MinSize {
+			c.decide(true)
+		}
+		return len(b), nil
+	}
+	if c.writer != nil {
+		return c.writer.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Decide whether to compress, then write the header and any buffered data.
+func (c *compressWriter) decide(large bool) {
+	c.decided = true
+	header := c.Header()
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if header.Get("Content-Type") == "" && c.buf.Len() > 0 {
+		header.Set("Content-Type", http.DetectContentType(c.buf.Bytes()))
+	}
+	compressible := c.options.compressible(header.Get("Content-Type"))
+	if compressible {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if large && compressible && header.Get("Content-Encoding") == "" &&
+		c.status != http.StatusNoContent && c.status != http.StatusNotModified {
+		header.Set("Content-Encoding", c.coding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			// The compressed representation is a different entity, but it
+			// must still satisfy If-Match, so mark the tag with the coding
+			// rather than weakening it.
+			header.Set("ETag", etagWithCoding(etag, c.coding))
+		}
+		c.writer = c.compressor.NewWriter(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	if c.buf.Len() > 0 {
+		c.Write(c.buf.Bytes())
+		c.buf.Reset()
+	}
+}
+
+// Flush forces a decision, so that streamed responses are not held in the
+// buffer.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		c.decide(true)
+	}
+	if f, ok := c.writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Close completes the response, compressing it only if it was large enough.
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if c.status == 0 && c.buf.Len() == 0 {
+			return nil
+		}
+		c.decide(c.buf.Len() >= c.options.MinSize)
+	}
+	if c.writer != nil {
+		return c.writer.Close()
+	}
+	return nil
+}
+
+// Wrap a response body with a decompressor for its Content-Encoding.
+func decompressResponse(resp *http.Response) error {
+	coding := resp.Header.Get("Content-Encoding")
+	if coding == "" || coding == "identity" {
+		return nil
+	}
+	compressor, ok := Compressors.Lookup(coding)
+	if !ok {
+		return &ClientError{status: resp.StatusCode, err: "unsupported Content-Encoding " + coding}
+	}
+	reader, err := compressor.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = &decompressedBody{reader, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+type decompressedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (d *decompressedBody) Close() error {
+	d.ReadCloser.Close()
+	io.Copy(ioutil.Discard, d.body)
+	return d.body.Close()
+}
@@ -0,0 +1,57 @@
+package pathways
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func zlibCompress(t *testing.T, data string) []byte {
+	buf := &bytes.Buffer{}
+	w := zlib.NewWriter(buf)
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDeflateRequestBodyIsZlib(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/echo").Post().APIRequestType(&resourceItem{}).APIFunction(func(cx *Context, item *resourceItem) *Response {
+		return cx.APIResponse(http.StatusOK, item)
+	})
+	req := httptest.NewRequest("POST", "/api/echo", bytes.NewReader(zlibCompress(t, `{"Name":"x"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "deflate")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "{\"Name\":\"x\"}\n" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body)
+	}
+}
+
+func TestDeflateResponseIsZlib(t *testing.T) {
+	s := NewService("/api").Compression(CompressionOptions{MinSize: 1})
+	s.Path("/item").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, &resourceItem{Name: "x"})
+	})
+	req := httptest.NewRequest("GET", "/api/item", nil)
+	req.Header.Set("Accept-Encoding", "deflate")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("expected a deflate response but got %q", w.Header().Get("Content-Encoding"))
+	}
+	r, err := zlib.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil || string(body) != "{\"Name\":\"x\"}\n" {
+		t.Fatalf("unexpected body %q: %v", body, err)
+	}
+}
@@ -2,6 +2,7 @@ package pathways
 
 import (
 	"html/template"
+	"mime"
 	"net/http"
 )
 
@@ -16,32 +17,111 @@ type Context struct {
 	Vars map[string]interface{}
 	// Template, if any.
 	Template *template.Template
+	// Trace context of the server span handling this request.
+	Trace SpanContext
+	// Unique ID of this request, from X-Request-ID.
+	RequestID string
+
+	serializers *SerializerRegistry
+	strict      bool
+	body        *limitedBody
+	route       *Route
+	links       Links
+	stream      *EventStream
+	// Outermost response writer, which records the status even once
+	// Response has been wrapped, eg. for compression.
+	status *statusWriter
 }
 
+// Serializers used to decode requests and encode responses.
+func (c *Context) Serializers() *SerializerRegistry {
+	if c.serializers != nil {
+		return c.serializers
+	}
+	return Serializers
+}
+
+// InferContentType negotiates the response content type by matching the
+// Accept header against the registered serializers. If the client accepts
+// anything, defaultContentType is used, or if that is empty the request
+// Content-Type. Request content types that can only be decoded, such as
+// multipart/form-data, fall back to JSON.
+//
+// If no registered serializer is acceptable the client's most preferred type
+// is returned as-is.
 func (c *Context) InferContentType(defaultContentType string) string {
-	ct := c.Request.Header.Get("Accept")
-	if ct == "*/*" || ct == "" {
-		if defaultContentType != "" {
-			ct = defaultContentType
-		} else {
-			ct = c.Request.Header.Get("Content-Type")
+	serializers := c.Serializers()
+	if defaultContentType == "" {
+		defaultContentType = c.RequestContentType("")
+		if serializers.decodeOnly(defaultContentType) {
+			defaultContentType = "application/json"
 		}
 	}
-	return ct
+	accept := c.Request.Header.Get("Accept")
+	if accept == "" {
+		return defaultContentType
+	}
+	contentType := negotiateContentType(parseAccept(accept), serializers.responseContentTypes(), defaultContentType)
+	if serializers.decodeOnly(contentType) {
+		return "application/json"
+	}
+	return contentType
+}
+
+// RequestContentType returns the media type of the request body, without
+// parameters, or defaultContentType if the request has no Content-Type.
+func (c *Context) RequestContentType(defaultContentType string) string {
+	ct := c.Request.Header.Get("Content-Type")
+	if ct == "" {
+		return defaultContentType
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ct
+	}
+	return mediaType
 }
 
 // Render a template.
 func (c *Context) APIError(code int, error string) *Response {
 	return c.APIResponse(code, &APIError{
-		Status: code,
-		Error:  error,
+		Status:    code,
+		Error:     error,
+		RequestID: c.RequestID,
 	})
 }
 
+// ValidationError responds with a 422 APIError listing each failing field
+// if err is a ValidationErrors.
+func (c *Context) ValidationError(err error) *Response {
+	apiError := &APIError{
+		Status:    http.StatusUnprocessableEntity,
+		Error:     err.Error(),
+		RequestID: c.RequestID,
+	}
+	if fields, ok := err.(ValidationErrors); ok {
+		apiError.Error = "validation failed"
+		apiError.Fields = fields
+	}
+	return c.APIResponse(http.StatusUnprocessableEntity, apiError)
+}
+
 func (c *Context) APIResponse(code int, response interface{}) *Response {
 	return ResponseFromContext(c, func(w http.ResponseWriter) {
-		contentType := c.InferContentType("application/json")
-		Serializers.EncodeResponse(w, code, contentType, response)
+		defaultContentType := "application/json"
+		if envelope := c.routeEnvelope(); envelope != nil && code >= 200 && code <= 299 {
+			defaultContentType = envelope.ContentType()
+		}
+		contentType := c.InferContentType(defaultContentType)
+		response = c.wrap(code, contentType, c.project(code, response))
+		c.Serializers().Map().encodeResponse(w, code, contentType, response, c.writeConditional)
+	})
+}
+
+// Status responds with a status code and no body.
+func (c *Context) Status(code int) *Response {
+	return ResponseFromContext(c, func(w http.ResponseWriter) {
+		w.WriteHeader(code)
 	})
 }
 
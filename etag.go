@@ -0,0 +1,91 @@
+package pathways
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Write an encoded API response, answering conditional GET and HEAD
+// requests. A strong ETag is generated from the encoded bytes unless the
+// handler supplied one, and 304 Not Modified is returned if it matches
+// If-None-Match, or if Last-Modified is not after If-Modified-Since.
+func (c *Context) writeConditional(w http.ResponseWriter, code int, contentType string, buf *bytes.Buffer) {
+	method := c.Request.Method
+	if (method != "GET" && method != "HEAD") || code != http.StatusOK {
+		writeBuffer(w, code, contentType, buf)
+		return
+	}
+	header := w.Header()
+	if header.Get("ETag") == "" {
+		sum := sha256.Sum256(buf.Bytes())
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+	if notModified(c.Request, header) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeBuffer(w, code, contentType, buf)
+}
+
+// Evaluate If-None-Match and If-Modified-Since against response headers.
+func notModified(request *http.Request, header http.Header) bool {
+	if inm := request.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, header.Get("ETag"), false)
+	}
+	ims, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// Returns true if etag matches any tag in a comma separated If-Match or
+// If-None-Match header. Strong comparison requires both tags to be strong.
+func etagMatches(header, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = stripETagCoding(strings.TrimSpace(tag))
+		if strong && strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Tag a strong ETag with the content coding of a compressed representation,
+// eg. "abc" becomes "abc-gzip".
+func etagWithCoding(etag, coding string) string {
+	return strings.TrimSuffix(etag, `"`) + "-" + coding + `"`
+}
+
+// Remove any content coding added to an ETag by etagWithCoding, so that tags
+// of compressed representations match the uncompressed entity.
+func stripETagCoding(etag string) string {
+	for _, coding := range Compressors.Codings() {
+		if suffix := "-" + coding + `"`; strings.HasSuffix(etag, suffix) {
+			return strings.TrimSuffix(etag, suffix) + `"`
+		}
+	}
+	return etag
+}
@@ -0,0 +1,111 @@
+package pathways
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var etagModified = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func etagService(root string, calls *int) *Service {
+	s := NewService(root)
+	s.Path("/item").Name("Item").Get().APIResponseType(&resourceItem{})
+	s.Path("/item").Name("Update").Post().APIResponseType(&resourceItem{})
+	s.Path("/modified").Name("Modified").Get().APIResponseType(&resourceItem{})
+	if calls == nil {
+		return s
+	}
+	s.Find("Item").APIFunction(func(cx *Context) *Response {
+		*calls++
+		return cx.APIResponse(http.StatusOK, &resourceItem{Name: "x"})
+	})
+	s.Find("Update").APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, &resourceItem{Name: "x"})
+	})
+	s.Find("Modified").APIFunction(func(cx *Context) *Response {
+		*calls++
+		return cx.APIResponse(http.StatusOK, &resourceItem{Name: "x"}).LastModified(etagModified)
+	})
+	return s
+}
+
+func conditionalRequest(s *Service, method, path, header, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestConditionalGet(t *testing.T) {
+	calls := 0
+	s := etagService("/api", &calls)
+	w := conditionalRequest(s, "GET", "/api/item", "", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || etag[0] != '"' {
+		t.Fatalf("expected a strong ETag but got %d %q", w.Code, etag)
+	}
+	if again := conditionalRequest(s, "GET", "/api/item", "", ""); again.Header().Get("ETag") != etag {
+		t.Errorf("expected a stable ETag but got %q and %q", etag, again.Header().Get("ETag"))
+	}
+	if w := conditionalRequest(s, "POST", "/api/item", "", ""); w.Header().Get("ETag") != "" {
+		t.Errorf("unexpected ETag on a POST response %q", w.Header().Get("ETag"))
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		header string
+		value  string
+		status int
+	}{
+		{"GET", "/api/item", "If-None-Match", etag, http.StatusNotModified},
+		{"GET", "/api/item", "If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"GET", "/api/item", "If-None-Match", "*", http.StatusNotModified},
+		{"GET", "/api/item", "If-None-Match", `"other"`, http.StatusOK},
+		{"GET", "/api/modified", "If-Modified-Since", etagModified.Format(http.TimeFormat), http.StatusNotModified},
+		{"GET", "/api/modified", "If-Modified-Since", etagModified.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified},
+		{"GET", "/api/modified", "If-Modified-Since", etagModified.Add(-time.Second).Format(http.TimeFormat), http.StatusOK},
+		{"GET", "/api/modified", "If-Modified-Since", "yesterday", http.StatusOK},
+	}
+	for _, test := range tests {
+		w := conditionalRequest(s, test.method, test.path, test.header, test.value)
+		if w.Code != test.status {
+			t.Errorf("%s %s %s: %s: expected %d but got %d", test.method, test.path, test.header, test.value, test.status, w.Code)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("Content-Type") != "") {
+			t.Errorf("%s %s: expected an empty 304 but got %q", test.header, test.value, w.Body.String())
+		}
+	}
+}
+
+func TestClientCacheRevalidates(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(etagService("/api", &calls))
+	defer server.Close()
+	client := NewClient(etagService(server.URL+"/api", nil), "application/json").Cache(NewMemoryCache(10))
+	for _, name := range []string{"Item", "Modified"} {
+		calls = 0
+		for i := 0; i < 3; i++ {
+			item := &resourceItem{}
+			resp, err := client.Call(name, Args{}, nil, item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := http.StatusOK
+			if i > 0 {
+				expected = http.StatusNotModified
+			}
+			if resp.StatusCode != expected || item.Name != "x" {
+				t.Errorf("%s %d: expected %d with the item but got %d %+v", name, i, expected, resp.StatusCode, item)
+			}
+		}
+		if calls != 3 {
+			t.Errorf("%s: expected every call to be revalidated with the server but got %d calls", name, calls)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package pathways
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 )
@@ -70,16 +71,23 @@ func MatchPath(path string) StageAcceptor {
 	return realMatchPath(path)
 }
 
+// Paths are matched in their escaped form, so that an escaped "/" in a path
+// variable does not split it, and each variable is then unescaped.
 func (m *matchPath) Accept(cx *Context) bool {
-	args := m.pattern.FindStringSubmatch(cx.Request.RequestURI)
-	if args != nil {
-		cx.PathVars = make(map[string]string)
-		for i, name := range m.params {
-			cx.PathVars[name] = args[i+1]
+	args := m.pattern.FindStringSubmatch(cx.Request.URL.EscapedPath())
+	if args == nil {
+		return false
+	}
+	vars := make(map[string]string)
+	for i, name := range m.params {
+		value, err := url.PathUnescape(args[i+1])
+		if err != nil {
+			return false
 		}
-		return true
+		vars[name] = value
 	}
-	return false
+	cx.PathVars = vars
+	return true
 }
 
 func (m *matchPath) String() string {
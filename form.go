@@ -0,0 +1,379 @@
+package pathways
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default maximum memory used to store multipart form parts. Larger files are
+// stored in temporary files on disk.
+const DefaultMaxFormMemory = 32 << 20
+
+// MaxFormSliceLen is the largest number of elements a form key such as
+// "items[0]" may index, so that a client can not allocate an arbitrarily
+// large slice with a single key.
+var MaxFormSliceLen = 1000
+
+// A RequestDecoder is a Serializer that needs access to the whole request,
+// not just the body, in order to decode it.
+type RequestDecoder interface {
+	DecodeRequest(req *http.Request, v interface{}) error
+}
+
+// FormSerializer decodes application/x-www-form-urlencoded and
+// multipart/form-data request bodies into structs.
+//
+// Fields are mapped with `form:"name"` tags, defaulting to the field name.
+// Nested structs, maps and slices are addressed with dotted or bracketed
+// keys, eg. "address.city", "address[city]", "tags[]", "items[0].name".
+// Uploaded files are assigned to fields of type *multipart.FileHeader or
+// []*multipart.FileHeader.
+//
+// Values can also be encoded as application/x-www-form-urlencoded, using the
+// same field mapping. multipart/form-data can only be decoded.
+type FormSerializer struct {
+	// Maximum memory used to store multipart parts, with the remainder
+	// stored on disk. Defaults to DefaultMaxFormMemory.
+	MaxMemory int64
+	// Multipart serializers decode multipart/form-data, and can not encode.
+	Multipart bool
+}
+
+// ErrMultipartEncoding is returned when encoding multipart/form-data.
+var ErrMultipartEncoding = errors.New("multipart/form-data can not be encoded")
+
+func (f *FormSerializer) maxMemory() int64 {
+	if f.MaxMemory > 0 {
+		return f.MaxMemory
+	}
+	return DefaultMaxFormMemory
+}
+
+func (f *FormSerializer) DecodeRequest(req *http.Request, v interface{}) error {
+	ct := req.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "multipart/form-data") {
+		if err := req.ParseMultipartForm(f.maxMemory()); err != nil {
+			return err
+		}
+		if err := decodeForm(req.MultipartForm.Value, v); err != nil {
+			return err
+		}
+		return decodeFormFiles(req.MultipartForm.File, v)
+	}
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+	return decodeForm(req.PostForm, v)
+}
+
+func (f *FormSerializer) NewEncoder(w io.Writer) ContentTypeEncoder {
+	if f.Multipart {
+		return encoderFunc(func(interface{}) error { return ErrMultipartEncoding })
+	}
+	return &formEncoder{w}
+}
+
+func (f *FormSerializer) canEncode() bool {
+	return !f.Multipart
+}
+
+type encoderFunc func(v interface{}) error
+
+func (e encoderFunc) Encode(v interface{}) error {
+	return e(v)
+}
+
+func (f *FormSerializer) NewDecoder(r io.Reader) ContentTypeDecoder {
+	return &formDecoder{r}
+}
+
+type formEncoder struct {
+	w io.Writer
+}
+
+func (f *formEncoder) Encode(v interface{}) error {
+	values := url.Values{}
+	if err := encodeForm("", reflect.ValueOf(v), values); err != nil {
+		return err
+	}
+	_, err := io.WriteString(f.w, values.Encode())
+	return err
+}
+
+type formDecoder struct {
+	r io.Reader
+}
+
+func (f *formDecoder) Decode(v interface{}) error {
+	body, err := ioutil.ReadAll(f.r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+	return decodeForm(values, v)
+}
+
+// Split a form key such as "a.b[0][c]" into its path ["a", "b", "0", "c"].
+func splitFormKey(key string) []string {
+	path := []string{}
+	for _, part := range strings.Split(key, ".") {
+		for {
+			open := strings.IndexByte(part, '[')
+			if open == -1 || !strings.HasSuffix(part, "]") {
+				path = append(path, part)
+				break
+			}
+			close := strings.IndexByte(part[open:], ']') + open
+			if open > 0 {
+				path = append(path, part[:open])
+			}
+			path = append(path, part[open+1:close])
+			part = part[close+1:]
+			if part == "" {
+				break
+			}
+		}
+	}
+	return path
+}
+
+func decodeForm(values map[string][]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("form: can not decode into non-pointer %T", v)
+	}
+	for _, key := range sortedFormKeys(values) {
+		if err := setFormValue(rv, splitFormKey(key), values[key]); err != nil {
+			return fmt.Errorf("form: %s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+func decodeFormFiles(files map[string][]*multipart.FileHeader, v interface{}) error {
+	keys := []string{}
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := setFormFiles(reflect.ValueOf(v), splitFormKey(key), files[key]); err != nil {
+			return fmt.Errorf("form: %s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+func sortedFormKeys(values map[string][]string) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	fileHeaderType  = reflect.TypeOf(&multipart.FileHeader{})
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader{})
+)
+
+// Walk path from v, allocating as required, and call leaf with the value at
+// the end of the path. Unknown keys are ignored.
+func walkFormPath(v reflect.Value, path []string, leaf func(v reflect.Value) error) error {
+	for v.Kind() == reflect.Ptr && v.Type() != fileHeaderType {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return leaf(v)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok := formField(v, path[0])
+		if !ok {
+			return nil
+		}
+		return walkFormPath(field, path[1:], leaf)
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(key); existing.IsValid() {
+			elem.Set(existing)
+		}
+		if err := walkFormPath(elem, path[1:], leaf); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+
+	case reflect.Slice:
+		if path[0] == "" {
+			return walkFormPath(v, path[1:], leaf)
+		}
+		index, err := strconv.Atoi(path[0])
+		if err != nil || index < 0 {
+			return fmt.Errorf("invalid index %q", path[0])
+		}
+		if index >= MaxFormSliceLen {
+			return fmt.Errorf("index %d exceeds the maximum of %d elements", index, MaxFormSliceLen)
+		}
+		if index >= v.Len() {
+			grown := reflect.MakeSlice(v.Type(), index+1, index+1)
+			reflect.Copy(grown, v)
+			v.Set(grown)
+		}
+		return walkFormPath(v.Index(index), path[1:], leaf)
+	}
+	// Keys that continue past a scalar field are ignored.
+	return nil
+}
+
+func setFormValue(v reflect.Value, path []string, values []string) error {
+	return walkFormPath(v, path, func(v reflect.Value) error {
+		if len(values) == 0 {
+			return nil
+		}
+		if v.Kind() == reflect.Slice {
+			for _, value := range values {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := setFormLeaf(elem, value); err != nil {
+					return err
+				}
+				v.Set(reflect.Append(v, elem))
+			}
+			return nil
+		}
+		return setFormLeaf(v, values[0])
+	})
+}
+
+func setFormLeaf(v reflect.Value, value string) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	coerced, err := coerce(value, v.Type())
+	if err != nil {
+		return err
+	}
+	v.Set(coerced)
+	return nil
+}
+
+func setFormFiles(v reflect.Value, path []string, files []*multipart.FileHeader) error {
+	return walkFormPath(v, path, func(v reflect.Value) error {
+		switch v.Type() {
+		case fileHeaderType:
+			v.Set(reflect.ValueOf(files[0]))
+		case fileHeadersType:
+			v.Set(reflect.AppendSlice(v, reflect.ValueOf(files)))
+		default:
+			return fmt.Errorf("can not assign file to %s", v.Type())
+		}
+		return nil
+	})
+}
+
+// Find the struct field for a form key.
+func formField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if name != "-" && formFieldName(field) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func formFieldName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("form"), ",")[0]
+	if tag == "" {
+		return field.Name
+	}
+	return tag
+}
+
+// Flatten v into form values, with nested keys joined by dots.
+func encodeForm(prefix string, v reflect.Value, values url.Values) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := formFieldName(field)
+			// Files can not be represented in a URL encoded form.
+			if field.PkgPath != "" || name == "-" || field.Type == fileHeaderType || field.Type == fileHeadersType {
+				continue
+			}
+			if err := encodeForm(join(name), v.Field(i), values); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range sortedMapKeys(v) {
+			if err := encodeForm(join(fmt.Sprint(key.Interface())), v.MapIndex(key), values); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct || elem.Kind() == reflect.Map {
+				if err := encodeForm(fmt.Sprintf("%s[%d]", prefix, i), elem, values); err != nil {
+					return err
+				}
+			} else {
+				values.Add(prefix, fmt.Sprint(elem.Interface()))
+			}
+		}
+	default:
+		if prefix == "" {
+			return fmt.Errorf("form: can not encode %s", v.Type())
+		}
+		values.Add(prefix, fmt.Sprint(v.Interface()))
+	}
+	return nil
+}
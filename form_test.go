@@ -0,0 +1,84 @@
+package pathways
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type uploadRequest struct {
+	Name string `form:"name"`
+}
+
+func TestMultipartIsDecodeOnly(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/upload").Post().APIRequestType(&uploadRequest{}).APIFunction(func(cx *Context, req *uploadRequest) *Response {
+		return cx.APIResponse(http.StatusOK, map[string]string{"name": req.Name})
+	})
+
+	for _, accept := range []string{"multipart/form-data", ""} {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField("name", "alice")
+		mw.Close()
+		req := httptest.NewRequest("POST", "/api/upload", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Accept %q: expected 200 but got %d: %s", accept, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("Accept %q: expected a JSON response but got %q", accept, ct)
+		}
+		if body := w.Body.String(); body != "{\"name\":\"alice\"}\n" {
+			t.Errorf("Accept %q: unexpected body %q", accept, body)
+		}
+	}
+}
+
+func TestMultipartEncoderErrors(t *testing.T) {
+	err := Serializers.Encode("multipart/form-data", &bytes.Buffer{}, map[string]string{"name": "alice"})
+	if err != ErrMultipartEncoding {
+		t.Errorf("expected ErrMultipartEncoding but got %v", err)
+	}
+}
+
+func TestFormSliceIndexIsBounded(t *testing.T) {
+	type formList struct {
+		Items []struct {
+			Name string
+		} `form:"items"`
+	}
+	s := NewService("/api")
+	s.Path("/list").Post().APIRequestType(&formList{}).APIFunction(func(cx *Context, req *formList) *Response {
+		return cx.APIResponse(http.StatusOK, len(req.Items))
+	})
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{"items[0].Name=a&items[2].Name=c", http.StatusOK},
+		{"items[999].Name=x", http.StatusOK},
+		{"items[1000].Name=x", http.StatusBadRequest},
+		{"items[20000000].Name=x", http.StatusBadRequest},
+		{"items[99999999999999].Name=x", http.StatusBadRequest},
+		{"items[-1].Name=x", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/api/list", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d but got %d: %s", test.body, test.status, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package pathways
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Media types of the hypermedia envelopes, registered with the default
+// Serializers as JSON.
+const (
+	HALContentType     = "application/hal+json"
+	JSONAPIContentType = "application/vnd.api+json"
+)
+
+// Link is a hypermedia link to a resource.
+type Link struct {
+	Href string `json:"href" xml:"href,attr"`
+}
+
+// Links are hypermedia links keyed by relation, eg. "self".
+type Links map[string]Link
+
+// Add a link to href with the relation rel.
+func (l Links) Add(rel, href string) Links {
+	l[rel] = Link{Href: href}
+	return l
+}
+
+// BaseURL returns the scheme and host the client used to reach the service,
+// eg. "https://api.example.com". X-Forwarded-Proto, X-Forwarded-Host and
+// X-Forwarded-Port are respected, so proxies must overwrite any values sent
+// by clients.
+func (c *Context) BaseURL() string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := forwardedHeader(c.Request, "X-Forwarded-Proto"); proto != "" {
+		scheme = strings.ToLower(proto)
+	}
+	host := c.Request.Host
+	if forwarded := forwardedHeader(c.Request, "X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	if port := forwardedHeader(c.Request, "X-Forwarded-Port"); port != "" {
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+		if !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+		}
+	}
+	return scheme + "://" + host
+}
+
+// First value of a possibly comma separated forwarding header, as appended
+// by each proxy.
+func forwardedHeader(request *http.Request, name string) string {
+	return strings.TrimSpace(strings.Split(request.Header.Get(name), ",")[0])
+}
+
+// URL returns the absolute URL of the named route in this service, with
+// args substituted for its path variables.
+func (c *Context) URL(name string, args Args) string {
+	if c.route == nil || c.route.service == nil {
+		panic("URL requires a route registered with a Service")
+	}
+	route := c.route.service.Find(name)
+	if route == nil {
+		panic("unknown route " + name)
+	}
+	return c.absoluteURL(route.Reverse(args))
+}
+
+func (c *Context) absoluteURL(path string) string {
+	if strings.Contains(path, "://") {
+		return path
+	}
+	return c.BaseURL() + path
+}
+
+// Links returns the hypermedia links of the response, which are embedded
+// by the route's Envelope.
+func (c *Context) Links() Links {
+	if c.links == nil {
+		c.links = Links{}
+	}
+	return c.links
+}
+
+// Link adds a link with the relation rel to the named route, eg.
+//
+//	cx.Link("self", "Get", pathways.Args{"id": id}).Link("collection", "List", nil)
+func (c *Context) Link(rel, name string, args Args) *Context {
+	c.Links().Add(rel, c.URL(name, args))
+	return c
+}
+
+// An Envelope wraps successful APIResponse payloads, along with the links
+// added to the Context.
+type Envelope interface {
+	// Media type to respond with when the client does not request another.
+	ContentType() string
+	Wrap(cx *Context, payload interface{}) interface{}
+}
+
+// Envelope wraps successful API responses of all routes in this service.
+func (s *Service) Envelope(envelope Envelope) *Service {
+	s.envelope = envelope
+	return s
+}
+
+// Envelope wraps successful API responses of this route, overriding the
+// service envelope.
+func (r *Route) Envelope(envelope Envelope) *Route {
+	r.envelope = envelope
+	return r
+}
+
+func (c *Context) routeEnvelope() Envelope {
+	switch {
+	case c.route == nil:
+		return nil
+	case c.route.envelope != nil:
+		return c.route.envelope
+	case c.route.service != nil:
+		return c.route.service.envelope
+	}
+	return nil
+}
+
+// Wrap an API response in the route's envelope, if any. Responses are only
+// wrapped if the envelope's media type was negotiated, so that clients
+// requesting plain JSON or msgpack receive the bare payload.
+func (c *Context) wrap(code int, contentType string, response interface{}) interface{} {
+	envelope := c.routeEnvelope()
+	if envelope == nil || code < 200 || code > 299 || contentType != envelope.ContentType() {
+		return response
+	}
+	if _, ok := response.(proto.Message); ok {
+		return response
+	}
+	return envelope.Wrap(c, response)
+}
+
+// HALEnvelope wraps responses as HAL documents. The fields of objects are
+// merged with "_links", while collections, including the Items of a Page, are
+// embedded as "_embedded.items".
+//
+// See https://datatracker.ietf.org/doc/html/draft-kelly-json-hal.
+type HALEnvelope struct{}
+
+func (HALEnvelope) ContentType() string { return HALContentType }
+
+func (HALEnvelope) Wrap(cx *Context, payload interface{}) interface{} {
+	var document map[string]interface{}
+	switch items := collectionItems(payload); {
+	case items != nil:
+		document = map[string]interface{}{"_embedded": map[string]interface{}{"items": items}}
+	default:
+		document = objectFields(payload)
+		if document == nil {
+			document = map[string]interface{}{"value": payload}
+		}
+	}
+	if len(cx.links) > 0 {
+		document["_links"] = cx.links
+	}
+	return document
+}
+
+// JSONAPIEnvelope wraps responses as JSON:API documents. Each object becomes
+// a resource object whose "id" is taken from its id field, converted to a
+// string, and whose remaining fields are its "attributes".
+//
+// See https://jsonapi.org/format/.
+type JSONAPIEnvelope struct {
+	// Resource type. Defaults to the lower-cased name of the payload type,
+	// or for maps the last static segment of the route path, eg. "items" for
+	// "/api/items/{id}".
+	Type string
+}
+
+func (JSONAPIEnvelope) ContentType() string { return JSONAPIContentType }
+
+func (j JSONAPIEnvelope) Wrap(cx *Context, payload interface{}) interface{} {
+	document := map[string]interface{}{}
+	if items := collectionItems(payload); items != nil {
+		data := make([]interface{}, len(items))
+		for i, item := range items {
+			data[i] = j.resource(cx, item)
+		}
+		document["data"] = data
+	} else {
+		document["data"] = j.resource(cx, payload)
+	}
+	if len(cx.links) > 0 {
+		links := map[string]string{}
+		for rel, link := range cx.links {
+			links[rel] = link.Href
+		}
+		document["links"] = links
+	}
+	return document
+}
+
+func (j JSONAPIEnvelope) resource(cx *Context, v interface{}) interface{} {
+	attributes := objectFields(v)
+	if attributes == nil {
+		return v
+	}
+	resource := map[string]interface{}{"type": j.resourceType(cx, v)}
+	for key, value := range attributes {
+		if strings.EqualFold(key, "id") {
+			if value != nil {
+				resource["id"] = jsonAPIID(value)
+			}
+			delete(attributes, key)
+		}
+	}
+	resource["attributes"] = attributes
+	return resource
+}
+
+func (j JSONAPIEnvelope) resourceType(cx *Context, v interface{}) string {
+	if j.Type != "" {
+		return j.Type
+	}
+	if t := indirectValue(reflect.ValueOf(v)); t.IsValid() && t.Kind() == reflect.Struct && t.Type().Name() != "" {
+		return strings.ToLower(t.Type().Name())
+	}
+	if cx.route != nil {
+		segments := strings.Split(strings.Trim(cx.route.path, "/"), "/")
+		for i := len(segments) - 1; i >= 0; i-- {
+			if segment := segments[i]; segment != "" && !strings.Contains(segment, "{") {
+				return segment
+			}
+		}
+	}
+	return "resource"
+}
+
+// JSON:API resource IDs are always strings.
+func jsonAPIID(id interface{}) string {
+	switch id := id.(type) {
+	case string:
+		return id
+	case float32:
+		return strconv.FormatFloat(float64(id), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	}
+	return fmt.Sprint(id)
+}
+
+// Elements of a slice payload, or the Items of a Page. Returns nil if the
+// payload is not a collection.
+func collectionItems(payload interface{}) []interface{} {
+	switch page := payload.(type) {
+	case *Page:
+		payload = page.Items
+	case Page:
+		payload = page.Items
+	}
+	v := indirectValue(reflect.ValueOf(payload))
+	if !v.IsValid() || v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items
+}
+
+// Fields of a struct or string keyed map, keyed by JSON name. Returns nil for
+// other values.
+func objectFields(payload interface{}) map[string]interface{} {
+	v := indirectValue(reflect.ValueOf(payload))
+	if !v.IsValid() {
+		return nil
+	}
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		fields := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			fields[key.String()] = v.MapIndex(key).Interface()
+		}
+		return fields
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		fields := map[string]interface{}{}
+		structObjectFields(v, fields)
+		return fields
+	}
+	return nil
+}
+
+func structObjectFields(v reflect.Value, fields map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if field.Anonymous && tag[0] == "" {
+			if embedded := indirectValue(v.Field(i)); embedded.Kind() == reflect.Struct {
+				structObjectFields(embedded, fields)
+			}
+			continue
+		}
+		if field.PkgPath != "" || tag[0] == "-" {
+			continue
+		}
+		value := v.Field(i)
+		if value.IsZero() && hasTagOption(tag[1:], "omitempty") {
+			continue
+		}
+		fields[wireFieldName(field)] = value.Interface()
+	}
+}
+
+func hasTagOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
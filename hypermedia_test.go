@@ -0,0 +1,186 @@
+package pathways
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type widget struct {
+	ID   int    `json:"id" msgpack:"id"`
+	Name string `json:"name" msgpack:"name"`
+}
+
+func widgetService(root string, envelope Envelope) *Service {
+	s := NewService(root).Envelope(envelope)
+	s.Path("/widgets/").Name("List").Get().APIResponseType([]widget{})
+	s.Path("/widgets/{id}").Name("Get").Get().APIResponseType(&widget{})
+	s.Path("/widgets/{id}/attributes").Name("Attributes").Get().APIResponseType(map[string]interface{}{})
+	return s
+}
+
+func widgetServer(envelope Envelope) *Service {
+	s := widgetService("/api", envelope)
+	s.Find("List").APIFunction(func(cx *Context) *Response {
+		cx.Link("self", "List", nil)
+		return cx.APIResponse(http.StatusOK, []widget{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}})
+	})
+	s.Find("Get").APIFunction(func(cx *Context) *Response {
+		if cx.PathVars["id"] != "7" {
+			return cx.APIError(http.StatusNotFound, "Not Found")
+		}
+		cx.Link("self", "Get", Args{"id": "7"})
+		return cx.APIResponse(http.StatusOK, &widget{ID: 7, Name: "seven"})
+	})
+	s.Find("Attributes").APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, map[string]interface{}{"id": 7.0, "colour": "red"})
+	})
+	return s
+}
+
+func getWidgets(t *testing.T, s *Service, path, accept string) (*httptest.ResponseRecorder, interface{}) {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	var body interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: invalid JSON %q: %s", path, w.Body.String(), err)
+	}
+	return w, body
+}
+
+func TestHALEnvelope(t *testing.T) {
+	s := widgetServer(HALEnvelope{})
+	for _, accept := range []string{"", "*/*", HALContentType} {
+		w, body := getWidgets(t, s, "/api/widgets/", accept)
+		if ct := w.Header().Get("Content-Type"); ct != HALContentType {
+			t.Errorf("Accept %q: expected %s but got %q", accept, HALContentType, ct)
+		}
+		expected := map[string]interface{}{
+			"_embedded": map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"id": 1.0, "name": "a"},
+				map[string]interface{}{"id": 2.0, "name": "b"},
+			}},
+			"_links": map[string]interface{}{"self": map[string]interface{}{"href": "http://example.com/api/widgets/"}},
+		}
+		if !reflect.DeepEqual(body, expected) {
+			t.Errorf("Accept %q: expected %#v but got %#v", accept, expected, body)
+		}
+	}
+
+	_, body := getWidgets(t, s, "/api/widgets/7", "")
+	expected := map[string]interface{}{
+		"id":     7.0,
+		"name":   "seven",
+		"_links": map[string]interface{}{"self": map[string]interface{}{"href": "http://example.com/api/widgets/7"}},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected %#v but got %#v", expected, body)
+	}
+}
+
+func TestEnvelopeIsOnlyAppliedToItsMediaType(t *testing.T) {
+	s := widgetServer(HALEnvelope{})
+	w, body := getWidgets(t, s, "/api/widgets/", "application/json")
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json but got %q", ct)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"id": 1.0, "name": "a"},
+		map[string]interface{}{"id": 2.0, "name": "b"},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected %#v but got %#v", expected, body)
+	}
+
+	req := httptest.NewRequest("GET", "/api/widgets/7", nil)
+	req.Header.Set("Accept", "application/x-msgpack")
+	mw := httptest.NewRecorder()
+	s.ServeHTTP(mw, req)
+	decoded := &widget{}
+	if err := msgpack.NewDecoder(bytes.NewReader(mw.Body.Bytes())).Decode(decoded); err != nil || *decoded != (widget{ID: 7, Name: "seven"}) {
+		t.Errorf("expected a bare msgpack widget but got %+v (%v)", decoded, err)
+	}
+
+	// Errors are never wrapped.
+	w, body = getWidgets(t, s, "/api/widgets/8", "")
+	if w.Code != http.StatusNotFound || body.(map[string]interface{})["Error"] != "Not Found" {
+		t.Errorf("unexpected error response %d %#v", w.Code, body)
+	}
+}
+
+func TestClientCallWithEnvelope(t *testing.T) {
+	server := httptest.NewServer(widgetServer(HALEnvelope{}))
+	defer server.Close()
+	client := NewClient(widgetService(server.URL+"/api", HALEnvelope{}), "application/json")
+	widgets := []widget{}
+	if _, err := client.Call("List", Args{}, nil, &widgets); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []widget{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}; !reflect.DeepEqual(widgets, expected) {
+		t.Errorf("expected %v but got %v", expected, widgets)
+	}
+}
+
+func TestJSONAPIEnvelope(t *testing.T) {
+	s := widgetServer(JSONAPIEnvelope{})
+	w, body := getWidgets(t, s, "/api/widgets/", "")
+	if ct := w.Header().Get("Content-Type"); ct != JSONAPIContentType {
+		t.Errorf("expected %s but got %q", JSONAPIContentType, ct)
+	}
+	expected := map[string]interface{}{
+		"data": []interface{}{
+			map[string]interface{}{"type": "widget", "id": "1", "attributes": map[string]interface{}{"name": "a"}},
+			map[string]interface{}{"type": "widget", "id": "2", "attributes": map[string]interface{}{"name": "b"}},
+		},
+		"links": map[string]interface{}{"self": "http://example.com/api/widgets/"},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected %#v but got %#v", expected, body)
+	}
+
+	// Map payloads are typed by the route path.
+	_, body = getWidgets(t, s, "/api/widgets/7/attributes", "")
+	expected = map[string]interface{}{
+		"data": map[string]interface{}{"type": "attributes", "id": "7", "attributes": map[string]interface{}{"colour": "red"}},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected %#v but got %#v", expected, body)
+	}
+
+	s = widgetServer(JSONAPIEnvelope{Type: "gadgets"})
+	_, body = getWidgets(t, s, "/api/widgets/7", "")
+	expected = map[string]interface{}{
+		"data":  map[string]interface{}{"type": "gadgets", "id": "7", "attributes": map[string]interface{}{"name": "seven"}},
+		"links": map[string]interface{}{"self": "http://example.com/api/widgets/7"},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected %#v but got %#v", expected, body)
+	}
+}
+
+func TestJSONAPIIDs(t *testing.T) {
+	for _, test := range []struct {
+		id       interface{}
+		expected string
+	}{
+		{"abc", "abc"},
+		{7, "7"},
+		{uint64(18446744073709551615), "18446744073709551615"},
+		{1e6, "1000000"},
+		{float32(2.5), "2.5"},
+	} {
+		if actual := jsonAPIID(test.id); actual != test.expected {
+			t.Errorf("%#v: expected %q but got %q", test.id, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package pathways
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBodySize is the maximum request body size, after decompression,
+// for routes and services that do not set their own.
+const DefaultMaxBodySize = 10 << 20
+
+// ErrBodyTooLarge is returned when reading a request body that exceeds the
+// route's maximum body size.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// MaxBodySize sets the maximum request body size for all routes in this
+// service, in bytes. A negative size disables the limit.
+func (s *Service) MaxBodySize(size int64) *Service {
+	s.maxBodySize = size
+	return s
+}
+
+// MaxBodySize sets the maximum request body size for this route, in bytes,
+// overriding the service limit. A negative size disables the limit.
+//
+// The limit applies both to the body as received and, for requests with a
+// Content-Encoding registered in Compressors, after decompression. Requests
+// exceeding it are rejected with 413 Request Entity Too Large.
+func (r *Route) MaxBodySize(size int64) *Route {
+	r.maxBodySize = size
+	return r
+}
+
+func (r *Route) bodyLimit() int64 {
+	switch {
+	case r.maxBodySize != 0:
+		return r.maxBodySize
+	case r.service != nil && r.service.maxBodySize != 0:
+		return r.service.maxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+// A request body that records whether its size limit was exceeded.
+type limitedBody struct {
+	io.Reader
+	closer   io.Closer
+	exceeded bool
+}
+
+func (l *limitedBody) Read(b []byte) (int, error) {
+	n, err := l.Reader.Read(b)
+	var maxBytesError *http.MaxBytesError
+	if err == ErrBodyTooLarge || errors.As(err, &maxBytesError) {
+		l.exceeded = true
+	}
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	return l.closer.Close()
+}
+
+// Reads at most n bytes before failing with ErrBodyTooLarge.
+type capReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *capReader) Read(b []byte) (int, error) {
+	if c.n <= 0 {
+		// Distinguish a body of exactly n bytes from one that is too large.
+		var probe [1]byte
+		if n, _ := c.r.Read(probe[:]); n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(b)) > c.n {
+		b = b[:c.n]
+	}
+	n, err := c.r.Read(b)
+	c.n -= int64(n)
+	return n, err
+}
+
+// Limit the size of the request body and transparently decompress it.
+// Returns an error response if the body can not be accepted.
+func (r *Route) limitBody(cx *Context) *Response {
+	request := cx.Request
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	limit := r.bodyLimit()
+	if limit > 0 && request.ContentLength > limit {
+		return cx.APIError(http.StatusRequestEntityTooLarge, ErrBodyTooLarge.Error())
+	}
+	var body io.Reader = request.Body
+	if limit > 0 {
+		body = http.MaxBytesReader(underlyingWriter(cx.Response), request.Body, limit)
+	}
+	encoding := strings.ToLower(strings.TrimSpace(request.Header.Get("Content-Encoding")))
+	if encoding == "x-gzip" {
+		encoding = "gzip"
+	}
+	if encoding != "" && encoding != "identity" {
+		compressor, ok := Compressors.Lookup(encoding)
+		if !ok {
+			return cx.APIError(http.StatusUnsupportedMediaType, "unsupported Content-Encoding "+encoding)
+		}
+		decompressed, err := compressor.NewReader(body)
+		if err != nil {
+			return cx.APIError(http.StatusBadRequest, "invalid "+encoding+" body: "+err.Error())
+		}
+		body = decompressed
+		request.Header.Del("Content-Encoding")
+		request.ContentLength = -1
+		if limit > 0 {
+			body = &capReader{body, limit}
+		}
+	}
+	cx.body = &limitedBody{Reader: body, closer: request.Body}
+	request.Body = cx.body
+	return nil
+}
+
+// Unwrap w to the writer provided by net/http, so that MaxBytesReader can
+// tell the server to close the connection once the limit is exceeded.
+func underlyingWriter(w http.ResponseWriter) http.ResponseWriter {
+	for {
+		wrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return w
+		}
+		w = wrapper.Unwrap()
+	}
+}
+
+// Returns true if reading the request body failed because it was too large.
+func (c *Context) bodyTooLarge() bool {
+	return c.body != nil && c.body.exceeded
+}
@@ -0,0 +1,86 @@
+package pathways
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type limitedItem struct {
+	Name string `json:"name"`
+}
+
+func limitedService() *Service {
+	s := NewService("/api").MaxBodySize(16)
+	s.Path("/items").Post().APIRequestType(&limitedItem{}).APIFunction(func(cx *Context, item *limitedItem) *Response {
+		return cx.APIResponse(http.StatusOK, item)
+	})
+	s.Path("/raw").Post().HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write(body)
+	})
+	return s
+}
+
+func TestMaxBodySize(t *testing.T) {
+	gzipped := &bytes.Buffer{}
+	gz := gzip.NewWriter(gzipped)
+	gz.Write([]byte(`{"name":"` + strings.Repeat("a", 100) + `"}`))
+	gz.Close()
+	tests := []struct {
+		name     string
+		path     string
+		body     []byte
+		encoding string
+		status   int
+	}{
+		{"Small", "/api/items", []byte(`{"name":"a"}`), "", http.StatusOK},
+		{"Large", "/api/items", []byte(`{"name":"` + strings.Repeat("a", 100) + `"}`), "", http.StatusRequestEntityTooLarge},
+		{"Decompressed", "/api/items", gzipped.Bytes(), "gzip", http.StatusRequestEntityTooLarge},
+		{"RawSmall", "/api/raw", []byte("small"), "", http.StatusOK},
+		{"RawLarge", "/api/raw", bytes.Repeat([]byte("a"), 100), "", http.StatusRequestEntityTooLarge},
+	}
+	s := limitedService()
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", test.path, bytes.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		if test.encoding != "" {
+			req.Header.Set("Content-Encoding", test.encoding)
+		}
+		// Hide the length so that the body itself is limited.
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d but got %d: %s", test.name, test.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMaxBodySizeClosesConnection(t *testing.T) {
+	// Compression wraps the response writer, which must not prevent the
+	// server from closing the connection after an oversized body.
+	server := httptest.NewServer(limitedService().Compression(CompressionOptions{}))
+	defer server.Close()
+	req, _ := http.NewRequest("POST", server.URL+"/api/raw", io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("a"), 100))))
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 but got %d", resp.StatusCode)
+	}
+	if !resp.Close {
+		t.Error("expected the server to close the connection")
+	}
+}
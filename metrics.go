@@ -0,0 +1,226 @@
+package pathways
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Latency histogram bucket upper bounds, in seconds.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Serialization errors across all SerializerMaps, keyed by operation and
+// content type.
+var serializerErrors = &errorCounter{counts: map[[2]string]uint64{}}
+
+type errorCounter struct {
+	lock   sync.Mutex
+	counts map[[2]string]uint64
+}
+
+func (e *errorCounter) inc(op, contentType string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.counts[[2]string{op, contentType}]++
+}
+
+type routeKey struct {
+	route  string
+	method string
+}
+
+// Standard HTTP methods. Others are counted as "OTHER", so that clients can
+// not create unbounded numbers of series.
+var standardMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "CONNECT": true, "OPTIONS": true, "TRACE": true,
+}
+
+// Label used for content types that have no registered serializer.
+const unsupportedContentTypeLabel = "unsupported"
+
+func metricsKey(route *Route, request *http.Request) routeKey {
+	key := routeKey{method: request.Method}
+	if !standardMethods[key.method] {
+		key.method = "OTHER"
+	}
+	if route != nil {
+		key.route = route.name
+	}
+	return key
+}
+
+type requestKey struct {
+	routeKey
+	code int
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range latencyBuckets {
+		if v <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Per-route request metrics.
+type metrics struct {
+	lock     sync.Mutex
+	requests map[requestKey]uint64
+	latency  map[routeKey]*histogram
+	inFlight map[routeKey]int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: map[requestKey]uint64{},
+		latency:  map[routeKey]*histogram{},
+		inFlight: map[routeKey]int64{},
+	}
+}
+
+func (m *metrics) begin(key routeKey) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.inFlight[key]++
+}
+
+func (m *metrics) end(key routeKey) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.inFlight[key]--
+}
+
+func (m *metrics) observe(key routeKey, code int, duration time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.requests[requestKey{key, code}]++
+	h, ok := m.latency[key]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.latency[key] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// MetricsHandler exposes request counters, latency histograms, in-flight
+// gauges and serialization error counters in the Prometheus text exposition
+// format.
+func (s *Service) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &bytes.Buffer{}
+		s.metrics.write(buf)
+		serializerErrors.write(buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+func (m *metrics) write(buf *bytes.Buffer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeMetricHeader(buf, "pathways_requests_total", "counter", "Total HTTP requests handled.")
+	requests := []requestKey{}
+	for key := range m.requests {
+		requests = append(requests, key)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].routeKey != requests[j].routeKey {
+			return requests[i].routeKey.less(requests[j].routeKey)
+		}
+		return requests[i].code < requests[j].code
+	})
+	for _, key := range requests {
+		fmt.Fprintf(buf, "pathways_requests_total{%s,code=\"%d\"} %d\n", key.labels(), key.code, m.requests[key])
+	}
+
+	writeMetricHeader(buf, "pathways_request_duration_seconds", "histogram", "HTTP request latency.")
+	latency := []routeKey{}
+	for key := range m.latency {
+		latency = append(latency, key)
+	}
+	sortRouteKeys(latency)
+	for _, key := range latency {
+		h := m.latency[key]
+		labels := key.labels()
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(buf, "pathways_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(le), h.buckets[i])
+		}
+		fmt.Fprintf(buf, "pathways_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(buf, "pathways_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.sum))
+		fmt.Fprintf(buf, "pathways_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	writeMetricHeader(buf, "pathways_requests_in_flight", "gauge", "HTTP requests currently being handled.")
+	inFlight := []routeKey{}
+	for key := range m.inFlight {
+		inFlight = append(inFlight, key)
+	}
+	sortRouteKeys(inFlight)
+	for _, key := range inFlight {
+		fmt.Fprintf(buf, "pathways_requests_in_flight{%s} %d\n", key.labels(), m.inFlight[key])
+	}
+}
+
+func (e *errorCounter) write(buf *bytes.Buffer) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	writeMetricHeader(buf, "pathways_serializer_errors_total", "counter", "Request decoding and response encoding errors.")
+	keys := [][2]string{}
+	for key := range e.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		fmt.Fprintf(buf, "pathways_serializer_errors_total{op=\"%s\",content_type=\"%s\"} %d\n",
+			escapeLabel(key[0]), escapeLabel(key[1]), e.counts[key])
+	}
+}
+
+func (k routeKey) less(o routeKey) bool {
+	if k.route != o.route {
+		return k.route < o.route
+	}
+	return k.method < o.method
+}
+
+func (k routeKey) labels() string {
+	return fmt.Sprintf("route=\"%s\",method=\"%s\"", escapeLabel(k.route), escapeLabel(k.method))
+}
+
+func sortRouteKeys(keys []routeKey) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
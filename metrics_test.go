@@ -0,0 +1,24 @@
+package pathways
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsCollapseNonStandardMethods(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/item").Get().APIFunction(func(cx *Context) *Response { return cx.Status(204) })
+	for _, method := range []string{"FOO", "BAR", "GET"} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/api/unknown", nil))
+	}
+	w := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := w.Body.String()
+	if strings.Contains(metrics, "FOO") || strings.Contains(metrics, "BAR") {
+		t.Fatalf("non-standard methods leaked into metrics:\n%s", metrics)
+	}
+	if !strings.Contains(metrics, `method="OTHER"`) || !strings.Contains(metrics, `method="GET"`) {
+		t.Fatalf("expected OTHER and GET series:\n%s", metrics)
+	}
+}
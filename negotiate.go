@@ -0,0 +1,92 @@
+package pathways
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A media range from an Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// Parse an Accept header into media ranges, ordered by descending quality.
+func parseAccept(header string) []acceptRange {
+	ranges := []acceptRange{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	return ranges
+}
+
+// Quality of mediaType under the most specific matching range, or -1 if no
+// range matches.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	best, specificity := -1.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mediaType == mediaType:
+			s = 2
+		case strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*")):
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			best, specificity = r.q, s
+		}
+	}
+	return best
+}
+
+// Select the best of the available content types for the accepted ranges.
+// Ties favour preferred, then the order in which the client listed them.
+func negotiateContentType(ranges []acceptRange, available []string, preferred string) string {
+	if len(ranges) == 0 {
+		return preferred
+	}
+	best, bestQ := "", 0.0
+	consider := func(ct string) {
+		if q := acceptQuality(ranges, ct); q > bestQ {
+			best, bestQ = ct, q
+		}
+	}
+	if preferred != "" {
+		consider(preferred)
+	}
+	for _, r := range ranges {
+		if !strings.Contains(r.mediaType, "*") {
+			for _, ct := range available {
+				if ct == r.mediaType {
+					consider(ct)
+				}
+			}
+		}
+	}
+	for _, ct := range available {
+		consider(ct)
+	}
+	if best == "" {
+		return ranges[0].mediaType
+	}
+	return best
+}
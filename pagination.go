@@ -0,0 +1,228 @@
+package pathways
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidCursor is returned when a pagination cursor has been
+	// tampered with or was signed with a different key.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrNoCursorKey is returned when encoding or decoding a cursor for a
+	// Context whose route is not registered with a Service.
+	ErrNoCursorKey = errors.New("pagination cursors require a route registered with a Service")
+)
+
+// Length of the truncated HMAC appended to cursors.
+const cursorMACSize = 16
+
+// PageRequest can be embedded in an APIRequestType to bind the "limit" and
+// "cursor" query parameters of a paginated list.
+type PageRequest struct {
+	Limit  int    `query:"limit"`
+	Cursor string `query:"cursor"`
+}
+
+// PageLimit returns the requested limit, or defaultLimit if none was
+// requested, clamped to max.
+func (p *PageRequest) PageLimit(defaultLimit, max int) int {
+	limit := p.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit
+}
+
+// Page is the response envelope for a page of a paginated list.
+type Page struct {
+	Items interface{}
+	// Opaque cursor for the next page, or empty on the last page.
+	Next string `json:",omitempty"`
+}
+
+// CursorKey sets the key used to sign pagination cursors. If not set, a
+// random key is generated, so cursors will not survive a restart or be
+// accepted by other instances of the service.
+func (s *Service) CursorKey(key []byte) *Service {
+	s.cursorKey = key
+	return s
+}
+
+func (s *Service) cursorSigningKey() []byte {
+	s.cursorOnce.Do(func() {
+		if s.cursorKey == nil {
+			s.cursorKey = make([]byte, 32)
+			rand.Read(s.cursorKey)
+		}
+	})
+	return s.cursorKey
+}
+
+func (c *Context) cursorKey() ([]byte, error) {
+	if c.route == nil || c.route.service == nil {
+		return nil, ErrNoCursorKey
+	}
+	return c.route.service.cursorSigningKey(), nil
+}
+
+// EncodeCursor serializes position, such as the last key returned, into an
+// opaque signed cursor.
+func (c *Context) EncodeCursor(position interface{}) (string, error) {
+	key, err := c.cursorKey()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(append(data, mac.Sum(nil)[:cursorMACSize]...)), nil
+}
+
+// DecodeCursor verifies a cursor created by EncodeCursor and decodes its
+// position into v. Returns ErrInvalidCursor if the cursor is not authentic.
+func (c *Context) DecodeCursor(cursor string, v interface{}) error {
+	key, err := c.cursorKey()
+	if err != nil {
+		return err
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) < cursorMACSize {
+		return ErrInvalidCursor
+	}
+	data, sum := raw[:len(raw)-cursorMACSize], raw[len(raw)-cursorMACSize:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	if !hmac.Equal(sum, mac.Sum(nil)[:cursorMACSize]) {
+		return ErrInvalidCursor
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Page responds with a page of items in a Page envelope. If next is not
+// nil it is encoded as the cursor for the following page, which is also
+// linked from an RFC 8288 Link header with rel="next".
+func (c *Context) Page(items interface{}, next interface{}) *Response {
+	page := &Page{Items: items}
+	if next != nil {
+		cursor, err := c.EncodeCursor(next)
+		if err != nil {
+			return c.APIError(http.StatusInternalServerError, err.Error())
+		}
+		page.Next = cursor
+	}
+	response := c.APIResponse(http.StatusOK, page)
+	if page.Next != "" {
+		next := c.pageURL(page.Next)
+		response.Header("Link", "<"+next+`>; rel="next"`)
+		c.Links().Add("next", c.absoluteURL(next))
+	}
+	return response
+}
+
+// URL of this route with the cursor query parameter replaced.
+func (c *Context) pageURL(cursor string) string {
+	path := c.Request.URL.Path
+	if c.route != nil {
+		path = c.route.Reverse(c.PathVars)
+	}
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+	return path + "?" + query.Encode()
+}
+
+// Extract the target of the Link header with the given relation.
+func linkTarget(header http.Header, rel string) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if param == "rel="+rel || param == `rel="`+rel+`"` {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// PageIterator walks the pages of a paginated list route, following Link
+// headers.
+type PageIterator struct {
+	client *Client
+	name   string
+	req    *http.Request
+	err    error
+}
+
+// Pages returns an iterator over the pages of the named list route.
+//
+//	pages := client.Pages("List", pathways.Args{}, 100)
+//	items := []*Item{}
+//	for pages.Next(&items) {
+//		...
+//	}
+//	if err := pages.Err(); err != nil {
+//		...
+//	}
+func (c *Client) Pages(name string, args Args, limit int) *PageIterator {
+	req, err := c.MakeRequest(name, args, nil)
+	if err == nil && limit > 0 {
+		query := req.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		req.URL.RawQuery = query.Encode()
+	}
+	return &PageIterator{client: c, name: name, req: req, err: err}
+}
+
+// Next fetches the next page, decoding its items into items, which must be a
+// pointer to a slice or map. Returns false when there are no more pages or
+// an error occurs.
+func (p *PageIterator) Next(items interface{}) bool {
+	if p.err != nil || p.req == nil {
+		return false
+	}
+	page := &Page{Items: items}
+	header := p.req.Header.Clone()
+	resp, err := p.client.send(p.name, p.req, page)
+	if err != nil {
+		p.err = err
+		return false
+	}
+	p.req = nil
+	if next := linkTarget(resp.Header, "next"); next != "" {
+		nextURL, err := resp.Request.URL.Parse(next)
+		if err != nil {
+			p.err = err
+			return true
+		}
+		p.req, p.err = http.NewRequest("GET", nextURL.String(), nil)
+		if p.err == nil {
+			p.req.Header = header
+		}
+	}
+	return true
+}
+
+// Err returns the error, if any, that stopped iteration.
+func (p *PageIterator) Err() error {
+	return p.err
+}
@@ -0,0 +1,195 @@
+package pathways
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type pagedItem struct {
+	ID int
+}
+
+type pagedListRequest struct {
+	PageRequest
+	Filter string `query:"filter"`
+}
+
+func pagedService(root string) *Service {
+	s := NewService(root)
+	s.Path("/items").Name("List").Get().APIRequestType(&pagedListRequest{}).APIResponseType(&Page{})
+	return s
+}
+
+// Serves n items, a page at a time, keyed by the ID of the last item.
+func pagedServer(n int) *Service {
+	s := pagedService("/api")
+	s.Find("List").APIFunction(func(cx *Context, req *pagedListRequest) *Response {
+		after := 0
+		if req.Cursor != "" {
+			if err := cx.DecodeCursor(req.Cursor, &after); err != nil {
+				return cx.APIError(http.StatusBadRequest, err.Error())
+			}
+		}
+		limit := req.PageLimit(2, 10)
+		items := []pagedItem{}
+		for id := after + 1; id <= n && len(items) < limit; id++ {
+			items = append(items, pagedItem{ID: id})
+		}
+		if len(items) == 0 || items[len(items)-1].ID == n {
+			return cx.Page(items, nil)
+		}
+		return cx.Page(items, items[len(items)-1].ID)
+	})
+	return s
+}
+
+// Returns a Context for a route of s, as seen by its action.
+func pagedContext(t *testing.T, s *Service) *Context {
+	t.Helper()
+	var context *Context
+	s.Path("/context").Get().APIFunction(func(cx *Context) *Response {
+		context = cx
+		return cx.APIResponse(http.StatusOK, nil)
+	})
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/context", nil))
+	if context == nil {
+		t.Fatal("route was not called")
+	}
+	return context
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cx := pagedContext(t, NewService("/api"))
+	position := map[string]interface{}{"id": 42.0, "name": "last"}
+	cursor, err := cx.EncodeCursor(position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := map[string]interface{}{}
+	if err := cx.DecodeCursor(cursor, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, position) {
+		t.Errorf("expected %#v but got %#v", position, decoded)
+	}
+}
+
+func TestCursorTamperingIsRejected(t *testing.T) {
+	cx := pagedContext(t, NewService("/api").CursorKey([]byte("secret")))
+	cursor, err := cx.EncodeCursor(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := pagedContext(t, NewService("/api").CursorKey([]byte("other"))).EncodeCursor(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := []byte(cursor)
+	if tampered[0] == 'A' {
+		tampered[0] = 'B'
+	} else {
+		tampered[0] = 'A'
+	}
+	for _, test := range []string{string(tampered), other, "", "not a cursor!", cursor[:len(cursor)-2]} {
+		var position int
+		if err := cx.DecodeCursor(test, &position); err != ErrInvalidCursor {
+			t.Errorf("%q: expected ErrInvalidCursor but got %v", test, err)
+		}
+	}
+}
+
+func TestCursorWithoutService(t *testing.T) {
+	cx := &Context{Request: httptest.NewRequest("GET", "/", nil)}
+	if _, err := cx.EncodeCursor(1); err != ErrNoCursorKey {
+		t.Errorf("expected ErrNoCursorKey but got %v", err)
+	}
+	var position int
+	if err := cx.DecodeCursor("AAAA", &position); err != ErrNoCursorKey {
+		t.Errorf("expected ErrNoCursorKey but got %v", err)
+	}
+}
+
+func TestPageLinkHeader(t *testing.T) {
+	s := pagedServer(5)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/api/items?filter=a&limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 but got %d: %s", w.Code, w.Body.String())
+	}
+	next := linkTarget(w.Header(), "next")
+	target, err := url.Parse(next)
+	if err != nil || target.Path != "/api/items" {
+		t.Fatalf("unexpected next link %q in %q", next, w.Header().Get("Link"))
+	}
+	query := target.Query()
+	if query.Get("filter") != "a" || query.Get("limit") != "2" || query.Get("cursor") == "" {
+		t.Errorf("next link did not preserve the query: %q", next)
+	}
+	if !strings.Contains(w.Body.String(), `"Next":"`+query.Get("cursor")+`"`) {
+		t.Errorf("body does not contain the next cursor: %s", w.Body.String())
+	}
+
+	// Following the links reaches the last page, which has none.
+	for i := 0; next != "" && i < 3; i++ {
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", next, nil))
+		next = linkTarget(w.Header(), "next")
+	}
+	if next != "" || strings.Contains(w.Body.String(), "Next") || !strings.Contains(w.Body.String(), `{"ID":5}`) {
+		t.Errorf("unexpected last page: %q %s", w.Header().Get("Link"), w.Body.String())
+	}
+}
+
+func TestLinkTarget(t *testing.T) {
+	tests := []struct {
+		links    []string
+		expected string
+	}{
+		{[]string{`</a?cursor=1>; rel="next"`}, "/a?cursor=1"},
+		{[]string{`</a>; rel=next`}, "/a"},
+		{[]string{`</prev>; rel="prev", </next>; rel="next"`}, "/next"},
+		{[]string{`</prev>; rel="prev"`, `</next>; title="x"; rel="next"`}, "/next"},
+		{[]string{`</prev>; rel="prev"`}, ""},
+		{[]string{`next; rel="next"`}, ""},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		for _, link := range test.links {
+			header.Add("Link", link)
+		}
+		if actual := linkTarget(header, "next"); actual != test.expected {
+			t.Errorf("%q: expected %q but got %q", test.links, test.expected, actual)
+		}
+	}
+}
+
+func TestPageIterator(t *testing.T) {
+	server := httptest.NewServer(pagedServer(5))
+	defer server.Close()
+	for _, encoding := range []string{"application/json", "application/x-msgpack"} {
+		client := NewClient(pagedService(server.URL+"/api"), encoding)
+		pages := client.Pages("List", Args{}, 2)
+		all := []pagedItem{}
+		count := 0
+		for {
+			items := []pagedItem{}
+			if !pages.Next(&items) {
+				break
+			}
+			count++
+			all = append(all, items...)
+		}
+		if err := pages.Err(); err != nil {
+			t.Fatalf("%s: %s", encoding, err)
+		}
+		expected := []pagedItem{{1}, {2}, {3}, {4}, {5}}
+		if count != 3 || !reflect.DeepEqual(all, expected) {
+			t.Errorf("%s: expected %v in 3 pages but got %v in %d", encoding, expected, all, count)
+		}
+	}
+}
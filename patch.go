@@ -0,0 +1,392 @@
+package pathways
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Content types of partial update documents.
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// ErrPatchTestFailed is returned when a JSON Patch "test" operation fails.
+var ErrPatchTestFailed = errors.New("patch test operation failed")
+
+// A CurrentFunc returns the current value of the resource addressed by a
+// request, or nil if it does not exist.
+type CurrentFunc func(cx *Context) (interface{}, error)
+
+// Patch matches PATCH requests. Request bodies must be JSON Merge Patch or
+// JSON Patch documents; other content types are rejected with a 415.
+func (r *Route) Patch() *Route {
+	r.patch = true
+	return r.Methods("PATCH")
+}
+
+// Current supplies the current value of the resource, against which JSON
+// Merge Patch (RFC 7396) and JSON Patch (RFC 6902) request bodies are
+// applied. The patched document is decoded into the APIRequestType value,
+// so handlers receive the complete, updated resource.
+//
+// Without a CurrentFunc patches are applied to an empty document.
+func (r *Route) Current(current CurrentFunc) *Route {
+	r.current = current
+	return r
+}
+
+func isPatchContentType(ct string) bool {
+	return ct == MergePatchContentType || ct == JSONPatchContentType
+}
+
+// Respond to a request to a Patch route that does not contain a patch
+// document.
+func unsupportedPatch(cx *Context, ct string) *Response {
+	return cx.APIError(http.StatusUnsupportedMediaType, fmt.Sprintf("expected %s or %s but got %q", MergePatchContentType, JSONPatchContentType, ct)).
+		Header("Accept-Patch", MergePatchContentType+", "+JSONPatchContentType)
+}
+
+// Decode a patch document from the request, apply it to the current value
+// of the resource and decode the result into v. Returns an error response on
+// failure.
+func decodePatch(cx *Context, ct string, v interface{}) *Response {
+	var current interface{} = map[string]interface{}{}
+	if cx.route != nil && cx.route.current != nil {
+		value, err := cx.route.current(cx)
+		if err != nil {
+			return cx.APIError(http.StatusInternalServerError, err.Error())
+		}
+		if value == nil {
+			return cx.APIError(http.StatusNotFound, "Not Found")
+		}
+		if current, err = toJSONDocument(value); err != nil {
+			return cx.APIError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	body, err := ioutil.ReadAll(cx.Request.Body)
+	if err != nil {
+		return cx.APIError(http.StatusBadRequest, err.Error())
+	}
+	var patched interface{}
+	switch ct {
+	case MergePatchContentType:
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return cx.APIError(http.StatusBadRequest, err.Error())
+		}
+		patched = MergePatch(current, patch)
+	case JSONPatchContentType:
+		operations := []PatchOperation{}
+		if err := json.Unmarshal(body, &operations); err != nil {
+			return cx.APIError(http.StatusBadRequest, err.Error())
+		}
+		patched, err = ApplyJSONPatch(current, operations)
+		if err == ErrPatchTestFailed {
+			return cx.APIError(http.StatusConflict, err.Error())
+		} else if err != nil {
+			return cx.APIError(http.StatusUnprocessableEntity, err.Error())
+		}
+	}
+	data, err := json.Marshal(patched)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return cx.APIError(http.StatusUnprocessableEntity, err.Error())
+	}
+	return nil
+}
+
+// Convert a Go value into its generic JSON representation.
+func toJSONDocument(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// MergePatch applies a JSON Merge Patch (RFC 7396) to a generic JSON
+// document, returning the result. target is not modified.
+func MergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	result := map[string]interface{}{}
+	if ok {
+		for key, value := range targetObject {
+			result[key] = value
+		}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = MergePatch(result[key], value)
+		}
+	}
+	return result
+}
+
+// A PatchOperation is a single JSON Patch (RFC 6902) operation.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// UnmarshalJSON rejects operations missing a member required by RFC 6902,
+// so that eg. an "add" without a "value" is not applied as null.
+func (p *PatchOperation) UnmarshalJSON(data []byte) error {
+	type patchOperation PatchOperation
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, (*patchOperation)(p)); err != nil {
+		return err
+	}
+	required := []string{"op", "path"}
+	switch p.Op {
+	case "add", "replace", "test":
+		required = append(required, "value")
+	case "move", "copy":
+		required = append(required, "from")
+	}
+	for _, member := range required {
+		if _, ok := members[member]; !ok {
+			return fmt.Errorf("patch operation %q is missing %q", p.Op, member)
+		}
+	}
+	return nil
+}
+
+// ApplyJSONPatch applies JSON Patch (RFC 6902) operations to a generic JSON
+// document, returning the result. Operations are applied atomically: if any
+// fails, an error is returned and doc is not modified.
+func ApplyJSONPatch(doc interface{}, operations []PatchOperation) (interface{}, error) {
+	doc = deepCopyJSON(doc)
+	var err error
+	for i, op := range operations {
+		switch op.Op {
+		case "add":
+			doc, err = pointerAdd(doc, op.Path, deepCopyJSON(op.Value))
+		case "remove":
+			doc, _, err = pointerRemove(doc, op.Path)
+		case "replace":
+			if doc, _, err = pointerRemove(doc, op.Path); err == nil {
+				doc, err = pointerAdd(doc, op.Path, deepCopyJSON(op.Value))
+			}
+		case "move":
+			var value interface{}
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				err = fmt.Errorf("can not move %q into itself", op.From)
+			} else if doc, value, err = pointerRemove(doc, op.From); err == nil {
+				doc, err = pointerAdd(doc, op.Path, value)
+			}
+		case "copy":
+			var value interface{}
+			if value, err = pointerGet(doc, op.From); err == nil {
+				doc, err = pointerAdd(doc, op.Path, deepCopyJSON(value))
+			}
+		case "test":
+			var value interface{}
+			if value, err = pointerGet(doc, op.Path); err == nil && !reflect.DeepEqual(value, op.Value) {
+				return nil, ErrPatchTestFailed
+			}
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s): %s", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func deepCopyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = deepCopyJSON(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = deepCopyJSON(value)
+		}
+		return out
+	}
+	return v
+}
+
+// Split a JSON Pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > length || (!allowEnd && index == length) {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+func pointerGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", pointer)
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+	}
+	return doc, nil
+}
+
+// Split a pointer into the parent container and the final token.
+func pointerParent(doc interface{}, pointer string) (interface{}, string, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, "", err
+	}
+	parent := "/" + strings.Join(escapeTokens(tokens[:len(tokens)-1]), "/")
+	if len(tokens) == 1 {
+		parent = ""
+	}
+	container, err := pointerGet(doc, parent)
+	return container, tokens[len(tokens)-1], err
+}
+
+func escapeTokens(tokens []string) []string {
+	out := make([]string, len(tokens))
+	for i, token := range tokens {
+		out[i] = strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+	}
+	return out
+}
+
+// Replace the container at pointer with value, returning the new document.
+func pointerSet(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	if pointer == "" {
+		return value, nil
+	}
+	container, token, err := pointerParent(doc, pointer)
+	if err != nil {
+		return nil, err
+	}
+	switch node := container.(type) {
+	case map[string]interface{}:
+		node[token] = value
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+	return doc, nil
+}
+
+func pointerAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	if pointer == "" {
+		return value, nil
+	}
+	container, token, err := pointerParent(doc, pointer)
+	if err != nil {
+		return nil, err
+	}
+	switch node := container.(type) {
+	case map[string]interface{}:
+		node[token] = value
+		return doc, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[index+1:], node[index:])
+		node[index] = value
+		return pointerSet(doc, parentPointer(pointer), node)
+	}
+	return nil, fmt.Errorf("path %q does not exist", pointer)
+}
+
+func pointerRemove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	if pointer == "" {
+		return nil, doc, nil
+	}
+	container, token, err := pointerParent(doc, pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch node := container.(type) {
+	case map[string]interface{}:
+		value, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+		delete(node, token)
+		return doc, value, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+		doc, err = pointerSet(doc, parentPointer(pointer), node)
+		return doc, value, err
+	}
+	return nil, nil, fmt.Errorf("path %q does not exist", pointer)
+}
+
+func parentPointer(pointer string) string {
+	return pointer[:strings.LastIndex(pointer, "/")]
+}
@@ -0,0 +1,193 @@
+package pathways
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeJSONForTest(t *testing.T, data string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("invalid JSON %s: %s", data, err)
+	}
+	return v
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+		err      string
+	}{
+		{name: "ReplaceArrayIndex", doc: `{"a":[1,2,3]}`, patch: `[{"op":"replace","path":"/a/1","value":9}]`, expected: `{"a":[1,9,3]}`},
+		{name: "AddArrayIndex", doc: `{"a":[1,2,3]}`, patch: `[{"op":"add","path":"/a/1","value":"x"}]`, expected: `{"a":[1,"x",2,3]}`},
+		{name: "AddArrayEnd", doc: `{"a":[1,2,3]}`, patch: `[{"op":"add","path":"/a/-","value":4}]`, expected: `{"a":[1,2,3,4]}`},
+		{name: "AddArrayLength", doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/1","value":2}]`, expected: `{"a":[1,2]}`},
+		{name: "AddNull", doc: `{}`, patch: `[{"op":"add","path":"/a","value":null}]`, expected: `{"a":null}`},
+		{name: "MoveWithinArray", doc: `{"a":[1,2,3]}`, patch: `[{"op":"move","from":"/a/0","path":"/a/2"}]`, expected: `{"a":[2,3,1]}`},
+		{name: "MoveArrayToEnd", doc: `{"a":[1,2,3]}`, patch: `[{"op":"move","from":"/a/0","path":"/a/-"}]`, expected: `{"a":[2,3,1]}`},
+		{name: "MoveArrayToObject", doc: `{"a":[1,2],"b":{}}`, patch: `[{"op":"move","from":"/a/1","path":"/b/c"}]`, expected: `{"a":[1],"b":{"c":2}}`},
+		{name: "CopyIsDeep", doc: `{"a":{"b":1}}`, patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, expected: `{"a":{"b":1},"c":{"b":2}}`},
+		{name: "RemoveArrayIndex", doc: `[1,2,3]`, patch: `[{"op":"remove","path":"/1"}]`, expected: `[1,3]`},
+		{name: "ReplaceRoot", doc: `{"a":1}`, patch: `[{"op":"replace","path":"","value":[1]}]`, expected: `[1]`},
+		{name: "EscapedSlash", doc: `{"a/b":1}`, patch: `[{"op":"replace","path":"/a~1b","value":2}]`, expected: `{"a/b":2}`},
+		{name: "EscapedTilde", doc: `{"m~n":1}`, patch: `[{"op":"remove","path":"/m~0n"}]`, expected: `{}`},
+		{name: "EscapedTildeOne", doc: `{"~1":1,"/":2}`, patch: `[{"op":"test","path":"/~01","value":1},{"op":"remove","path":"/~01"}]`, expected: `{"/":2}`},
+		{name: "TestPasses", doc: `{"a":{"b":[1,"x"]}}`, patch: `[{"op":"test","path":"/a","value":{"b":[1,"x"]}}]`, expected: `{"a":{"b":[1,"x"]}}`},
+		{name: "TestNull", doc: `{"a":null}`, patch: `[{"op":"test","path":"/a","value":null}]`, expected: `{"a":null}`},
+		{name: "TestFails", doc: `{"a":1}`, patch: `[{"op":"test","path":"/a","value":2}]`, err: ErrPatchTestFailed.Error()},
+		{name: "TestFailsOnType", doc: `{"a":1}`, patch: `[{"op":"test","path":"/a","value":"1"}]`, err: ErrPatchTestFailed.Error()},
+		{name: "TestMissingPath", doc: `{}`, patch: `[{"op":"test","path":"/a","value":null}]`, err: `path "/a" does not exist`},
+		{name: "ReplaceArrayEnd", doc: `{"a":[1]}`, patch: `[{"op":"replace","path":"/a/-","value":2}]`, err: `invalid array index "-"`},
+		{name: "ReplaceOutOfRange", doc: `{"a":[1]}`, patch: `[{"op":"replace","path":"/a/1","value":2}]`, err: "array index 1 out of range"},
+		{name: "AddPastEnd", doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/2","value":2}]`, err: "array index 2 out of range"},
+		{name: "LeadingZeroIndex", doc: `{"a":[1,2]}`, patch: `[{"op":"remove","path":"/a/01"}]`, err: `invalid array index "01"`},
+		{name: "NegativeIndex", doc: `{"a":[1,2]}`, patch: `[{"op":"remove","path":"/a/-1"}]`, err: `invalid array index "-1"`},
+		{name: "MissingParent", doc: `{}`, patch: `[{"op":"add","path":"/a/b","value":1}]`, err: `path "/a" does not exist`},
+		{name: "InvalidPointer", doc: `{}`, patch: `[{"op":"add","path":"a","value":1}]`, err: `invalid JSON pointer "a"`},
+		{name: "MoveIntoItself", doc: `{"a":{}}`, patch: `[{"op":"move","from":"/a","path":"/a/b"}]`, err: `can not move "/a" into itself`},
+		{name: "UnknownOperation", doc: `{}`, patch: `[{"op":"frob","path":"/a"}]`, err: `patch operation 0 (frob /a): unknown operation "frob"`},
+		{name: "ErrorReportsOperation", doc: `{"a":1}`, patch: `[{"op":"remove","path":"/a"},{"op":"remove","path":"/a"}]`, err: `patch operation 1 (remove /a): path "/a" does not exist`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operations := []PatchOperation{}
+			if err := json.Unmarshal([]byte(test.patch), &operations); err != nil {
+				t.Fatal(err)
+			}
+			doc := decodeJSONForTest(t, test.doc)
+			actual, err := ApplyJSONPatch(doc, operations)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := decodeJSONForTest(t, test.expected); !reflect.DeepEqual(actual, expected) {
+				t.Errorf("expected %#v but got %#v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchLeavesDocumentOnError(t *testing.T) {
+	doc := decodeJSONForTest(t, `{"a":[1,2,3],"b":{"c":"d"}}`)
+	original := decodeJSONForTest(t, `{"a":[1,2,3],"b":{"c":"d"}}`)
+	for _, patch := range []string{
+		`[{"op":"replace","path":"/a/0","value":9},{"op":"remove","path":"/missing"}]`,
+		`[{"op":"add","path":"/b/e","value":1},{"op":"move","from":"/a/1","path":"/b/c"},{"op":"test","path":"/b/c","value":"d"}]`,
+		`[{"op":"remove","path":"/a/0"},{"op":"replace","path":"/a/5","value":0}]`,
+	} {
+		operations := []PatchOperation{}
+		if err := json.Unmarshal([]byte(patch), &operations); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ApplyJSONPatch(doc, operations); err == nil {
+			t.Fatalf("expected %s to fail", patch)
+		}
+		if !reflect.DeepEqual(doc, original) {
+			t.Fatalf("%s modified the document: %#v", patch, doc)
+		}
+	}
+}
+
+func TestPatchOperationRequiredMembers(t *testing.T) {
+	tests := []struct {
+		patch string
+		err   string
+	}{
+		{`[{"op":"add","path":"/a"}]`, `patch operation "add" is missing "value"`},
+		{`[{"op":"replace","path":"/a"}]`, `patch operation "replace" is missing "value"`},
+		{`[{"op":"test","path":"/a"}]`, `patch operation "test" is missing "value"`},
+		{`[{"op":"move","path":"/a"}]`, `patch operation "move" is missing "from"`},
+		{`[{"op":"copy","path":"/a"}]`, `patch operation "copy" is missing "from"`},
+		{`[{"op":"remove"}]`, `patch operation "remove" is missing "path"`},
+		{`[{"path":"/a","value":1}]`, `patch operation "" is missing "op"`},
+		{`[{"op":"remove","path":"/a"}]`, ""},
+		{`[{"op":"add","path":"/a","value":null}]`, ""},
+		{`[{"op":"move","from":"","path":"/a"}]`, ""},
+	}
+	for _, test := range tests {
+		operations := []PatchOperation{}
+		err := json.Unmarshal([]byte(test.patch), &operations)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", test.patch, err)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: expected error %q but got %v", test.patch, test.err, err)
+		}
+	}
+}
+
+func TestJSONPatchMissingValueIsRejected(t *testing.T) {
+	type patchItem struct {
+		Name string `json:"name"`
+	}
+	s := NewService("/api")
+	s.Path("/item").Patch().APIRequestType(&patchItem{}).
+		Current(func(cx *Context) (interface{}, error) { return &patchItem{Name: "old"}, nil }).
+		APIFunction(func(cx *Context, item *patchItem) *Response {
+			return cx.APIResponse(http.StatusOK, item)
+		})
+	req := httptest.NewRequest("PATCH", "/api/item", strings.NewReader(`[{"op":"replace","path":"/name"}]`))
+	req.Header.Set("Content-Type", JSONPatchContentType)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 but got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `is missing \"value\"`) {
+		t.Errorf("unexpected error %s", w.Body.String())
+	}
+}
+
+func TestPatchRouteRejectsNonPatchContentTypes(t *testing.T) {
+	type patchItem struct {
+		Name  string
+		Owner string
+	}
+	s := NewService("/api")
+	s.Path("/item").Patch().APIRequestType(&patchItem{}).
+		Current(func(cx *Context) (interface{}, error) { return &patchItem{Name: "a", Owner: "bob"}, nil }).
+		APIFunction(func(cx *Context, item *patchItem) *Response {
+			return cx.APIResponse(http.StatusOK, item)
+		})
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{"application/json", `{"Name":"b"}`, http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", `Name=b`, http.StatusUnsupportedMediaType},
+		{"", ``, http.StatusUnsupportedMediaType},
+		{MergePatchContentType, `{"Name":"b"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("PATCH", "/api/item", strings.NewReader(test.body))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("%q: expected %d but got %d: %s", test.contentType, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if test.status == http.StatusUnsupportedMediaType {
+			if accept := w.Header().Get("Accept-Patch"); accept != MergePatchContentType+", "+JSONPatchContentType {
+				t.Errorf("%q: unexpected Accept-Patch %q", test.contentType, accept)
+			}
+		} else if body := w.Body.String(); body != "{\"Name\":\"b\",\"Owner\":\"bob\"}\n" {
+			t.Errorf("%q: unexpected body %s", test.contentType, body)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package pathways
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A VersionFunc returns the current entity tag of the resource addressed by
+// a request, or "" if the resource does not exist.
+type VersionFunc func(cx *Context) (string, error)
+
+// IfMatch requires requests to this route to carry an If-Match header
+// matching the current version of the resource, as returned by version.
+// Requests without If-Match are rejected with 428 Precondition Required,
+// and those that do not match with 412 Precondition Failed.
+//
+// eg.
+//
+//	route.Put().IfMatch(func(cx *pathways.Context) (string, error) {
+//		return store.Version(cx.PathVars["key"])
+//	})
+func (r *Route) IfMatch(version VersionFunc) *Route {
+	r.version = version
+	return r
+}
+
+// Evaluate If-Match preconditions, returning an error response if they are
+// not met.
+func (r *Route) checkPreconditions(cx *Context) *Response {
+	if r.version == nil {
+		return nil
+	}
+	ifMatch := cx.Request.Header.Get("If-Match")
+	if ifMatch == "" {
+		return cx.APIError(http.StatusPreconditionRequired, "If-Match header is required")
+	}
+	current, err := r.version(cx)
+	if err != nil {
+		return cx.APIError(http.StatusInternalServerError, err.Error())
+	}
+	if current != "" && !strings.HasPrefix(current, `"`) && !strings.HasPrefix(current, `W/"`) {
+		current = strconv.Quote(current)
+	}
+	if !etagMatches(ifMatch, current, true) {
+		response := cx.APIError(http.StatusPreconditionFailed, "resource has been modified")
+		if current != "" {
+			response.Header("ETag", current)
+		}
+		return response
+	}
+	return nil
+}
+
+// PreconditionFailedError is returned by the Client when the server responds
+// with 412 Precondition Failed.
+type PreconditionFailedError struct {
+	ClientError
+	// Current entity tag of the resource, if the server provided it.
+	ETag string
+}
@@ -0,0 +1,57 @@
+package pathways
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIfMatchRoundTripWithCompression(t *testing.T) {
+	version := "v1"
+	s := NewService("/api").Compression(CompressionOptions{MinSize: 1})
+	s.Path("/item").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, &resourceItem{Name: "x"}).ETag(version)
+	})
+	s.Path("/item").Put().APIRequestType(&resourceItem{}).
+		IfMatch(func(cx *Context) (string, error) { return version, nil }).
+		APIFunction(func(cx *Context, item *resourceItem) *Response {
+			version = "v2"
+			return cx.APIResponse(http.StatusOK, item)
+		})
+
+	req := httptest.NewRequest("GET", "/api/item", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+	if w.Header().Get("Content-Encoding") != "gzip" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("expected a strong ETag on a compressed response but got %q", etag)
+	}
+
+	put := func() int {
+		req := httptest.NewRequest("PUT", "/api/item", strings.NewReader(`{"Name":"y"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("If-Match", etag)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := put(); code != http.StatusOK {
+		t.Fatalf("expected If-Match %s to succeed but got %d", etag, code)
+	}
+	if code := put(); code != http.StatusPreconditionFailed {
+		t.Fatalf("expected a stale If-Match to fail but got %d", code)
+	}
+
+	// Conditional GETs still match the compressed representation.
+	req = httptest.NewRequest("GET", "/api/item", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", `"v2-gzip"`)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 but got %d", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package pathways
+
+import (
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// SparseFields enables sparse fieldsets for this route. When the request
+// has a "fields" query parameter, such as "?fields=name,owner.email", only
+// those fields of successful APIResponse payloads are encoded.
+//
+// Slices, and maps of structs, are projected element by element, as are the
+// Items of a Page.
+func (r *Route) SparseFields() *Route {
+	r.sparseFields = true
+	return r
+}
+
+// Apply sparse fieldset projection to an API response, if requested.
+func (c *Context) project(code int, response interface{}) interface{} {
+	if c.route == nil || !c.route.sparseFields || code < 200 || code > 299 {
+		return response
+	}
+	fields, err := ParseFields(c.Request.URL.Query().Get("fields"))
+	if err != nil || len(fields) == 0 {
+		return response
+	}
+	return Project(response, fields)
+}
+
+// Project returns a copy of v containing only the given fields, as maps
+// keyed by JSON field name. Unknown fields are ignored.
+func Project(v interface{}, fields FieldList) interface{} {
+	if len(fields) == 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case proto.Message:
+		return v
+	case *Page:
+		return &Page{Items: Project(v.Items, fields), Next: v.Next}
+	case Page:
+		return &Page{Items: Project(v.Items, fields), Next: v.Next}
+	}
+	return projectValue(reflect.ValueOf(v), fieldTree(fields), true)
+}
+
+// A tree of selected field paths. An empty tree selects everything.
+type projection map[string]projection
+
+func fieldTree(fields FieldList) projection {
+	tree := projection{}
+	for _, field := range fields {
+		node := tree
+		parts := strings.Split(field, ".")
+		for i, part := range parts {
+			child, ok := node[part]
+			if ok && len(child) == 0 {
+				// Already selected in full.
+				break
+			}
+			if i == len(parts)-1 {
+				node[part] = projection{}
+				break
+			}
+			if !ok {
+				child = projection{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// Project a value. Collections are only projected element-wise at the top
+// level, or when they are the value of a selected field.
+func projectValue(v reflect.Value, tree projection, collections bool) interface{} {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if len(tree) == 0 {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface()
+		}
+		out := map[string]interface{}{}
+		projectStruct(v, tree, out)
+		return out
+	case reflect.Slice, reflect.Array:
+		if !collections || v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = projectValue(v.Index(i), tree, false)
+		}
+		return out
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		elem := v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		out := map[string]interface{}{}
+		if collections && (elem.Kind() == reflect.Struct || elem.Kind() == reflect.Interface) {
+			for _, key := range v.MapKeys() {
+				out[key.String()] = projectValue(v.MapIndex(key), tree, false)
+			}
+			return out
+		}
+		for name, subtree := range tree {
+			if value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())); value.IsValid() {
+				out[name] = projectValue(value, subtree, true)
+			}
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+func projectStruct(v reflect.Value, tree projection, out map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			if embedded := indirectValue(v.Field(i)); embedded.Kind() == reflect.Struct {
+				projectStruct(embedded, tree, out)
+			}
+			continue
+		}
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		name := wireFieldName(field)
+		for selected, subtree := range tree {
+			if strings.EqualFold(selected, name) {
+				out[name] = projectValue(v.Field(i), subtree, true)
+			}
+		}
+	}
+}
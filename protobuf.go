@@ -0,0 +1,120 @@
+package pathways
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// protojson options used by JsonSerializer for proto.Message values.
+	protoJSONMarshal   = protojson.MarshalOptions{UseProtoNames: true}
+	protoJSONUnmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// ProtobufSerializer encodes and decodes proto.Message values in the
+// Protocol Buffers binary wire format. Values that are not a proto.Message
+// can not be encoded, so API errors are returned as JSON.
+type ProtobufSerializer struct{}
+
+func (p *ProtobufSerializer) NewEncoder(w io.Writer) ContentTypeEncoder {
+	return &protoEncoder{w}
+}
+
+func (p *ProtobufSerializer) NewDecoder(r io.Reader) ContentTypeDecoder {
+	return &protoDecoder{r}
+}
+
+type protoEncoder struct {
+	w io.Writer
+}
+
+func (p *protoEncoder) Encode(v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf: %T is not a proto.Message", v)
+	}
+	bytes, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = p.w.Write(bytes)
+	return err
+}
+
+type protoDecoder struct {
+	r io.Reader
+}
+
+func (p *protoDecoder) Decode(v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf: %T is not a proto.Message", v)
+	}
+	bytes, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(bytes, m)
+}
+
+// jsonEncoder uses protojson for proto.Message values, so that field names
+// and well-known types follow protobuf conventions, and encoding/json for
+// everything else.
+type jsonEncoder struct {
+	w       io.Writer
+	encoder *json.Encoder
+}
+
+func (j *jsonEncoder) Encode(v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return j.encoder.Encode(v)
+	}
+	bytes, err := protoJSONMarshal.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(append(bytes, '\n'))
+	return err
+}
+
+type jsonDecoder struct {
+	decoder *json.Decoder
+	strict  bool
+}
+
+func (j *jsonDecoder) Decode(v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		if err := j.decoder.Decode(v); err != nil {
+			return err
+		}
+		return j.checkTrailing()
+	}
+	raw := json.RawMessage{}
+	if err := j.decoder.Decode(&raw); err != nil {
+		return err
+	}
+	if err := j.checkTrailing(); err != nil {
+		return err
+	}
+	options := protoJSONUnmarshal
+	options.DiscardUnknown = !j.strict
+	return options.Unmarshal(raw, m)
+}
+
+// In strict mode, ensure nothing follows the decoded value.
+func (j *jsonDecoder) checkTrailing() error {
+	if !j.strict {
+		return nil
+	}
+	if _, err := j.decoder.Token(); err != io.EOF {
+		return ErrTrailingData
+	}
+	return nil
+}
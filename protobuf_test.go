@@ -0,0 +1,43 @@
+package pathways
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtobufErrorResponseKeepsStatus(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/missing").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIError(http.StatusNotFound, "not found")
+	})
+	s.Path("/value").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, wrapperspb.String("hello"))
+	})
+
+	req := httptest.NewRequest("GET", "/api/missing", nil)
+	req.Header.Set("Accept", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 but got %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected JSON error but got %q", ct)
+	}
+	apiError := &APIError{}
+	if err := json.Unmarshal(w.Body.Bytes(), apiError); err != nil || apiError.Error != "not found" {
+		t.Fatalf("unexpected error body %q: %v", w.Body, err)
+	}
+
+	req = httptest.NewRequest("GET", "/api/value", nil)
+	req.Header.Set("Accept", "application/x-protobuf")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-protobuf" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,753 @@
+package pathways
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ListQuery can be embedded in an APIRequestType to bind the "fields",
+// "filter" and "sort" query parameters of a list route, eg.
+//
+//	GET /items?fields=name,owner.email&filter=status eq 'open' and age gt 3&sort=-created
+type ListQuery struct {
+	Fields FieldList `query:"fields"`
+	Filter Filter    `query:"filter"`
+	Sort   SortOrder `query:"sort"`
+}
+
+// Apply the filter and sort order of the query to items, which must be a
+// slice. A new slice of the same type is returned.
+func (q *ListQuery) Apply(items interface{}) (interface{}, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("can't query %s, expected a slice", v.Type())
+	}
+	out := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		ok, err := q.Filter.Match(v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = reflect.Append(out, v.Index(i))
+		}
+	}
+	if err := q.Sort.Sort(out.Interface()); err != nil {
+		return nil, err
+	}
+	return out.Interface(), nil
+}
+
+// FieldList is a comma separated list of field paths, eg. "name,owner.email".
+type FieldList []string
+
+// ParseFields parses a comma separated list of field paths.
+func ParseFields(s string) (FieldList, error) {
+	fields := FieldList{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !isFieldPath(field) {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func (f *FieldList) UnmarshalText(text []byte) error {
+	fields, err := ParseFields(string(text))
+	if err != nil {
+		return err
+	}
+	*f = fields
+	return nil
+}
+
+func (f FieldList) MarshalText() ([]byte, error) {
+	return []byte(strings.Join(f, ",")), nil
+}
+
+// SortKey is a single field of a sort order.
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+func (s SortKey) String() string {
+	if s.Descending {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// SortOrder is a comma separated list of fields to sort by, each optionally
+// prefixed with "-" for descending or "+" for ascending order, eg.
+// "-created,name".
+type SortOrder []SortKey
+
+// ParseSort parses a sort order.
+func ParseSort(s string) (SortOrder, error) {
+	order := SortOrder{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key := SortKey{}
+		switch field[0] {
+		case '-':
+			key.Descending = true
+			field = field[1:]
+		case '+':
+			field = field[1:]
+		}
+		if !isFieldPath(field) {
+			return nil, fmt.Errorf("invalid sort field %q", field)
+		}
+		key.Field = field
+		order = append(order, key)
+	}
+	return order, nil
+}
+
+func (s *SortOrder) UnmarshalText(text []byte) error {
+	order, err := ParseSort(string(text))
+	if err != nil {
+		return err
+	}
+	*s = order
+	return nil
+}
+
+func (s SortOrder) MarshalText() ([]byte, error) {
+	keys := []string{}
+	for _, key := range s {
+		keys = append(keys, key.String())
+	}
+	return []byte(strings.Join(keys, ",")), nil
+}
+
+// Sort items, which must be a slice, in place.
+func (s SortOrder) Sort(items interface{}) error {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("can't sort %s, expected a slice", v.Type())
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	// Resolve keys up front so that errors can be reported.
+	keys := make([][]reflect.Value, v.Len())
+	for i := range keys {
+		keys[i] = make([]reflect.Value, len(s))
+		for j, key := range s {
+			field, err := lookupField(v.Index(i), key.Field)
+			if err != nil {
+				return err
+			}
+			keys[i][j] = field
+		}
+	}
+	var err error
+	index := make([]int, v.Len())
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(a, b int) bool {
+		for j, key := range s {
+			c, cerr := compareValues(keys[index[a]][j], keys[index[b]][j])
+			if cerr != nil && err == nil {
+				err = cerr
+			}
+			if c != 0 {
+				return (c < 0) != key.Descending
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	sorted := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	for i, j := range index {
+		sorted.Index(i).Set(v.Index(j))
+	}
+	reflect.Copy(v, sorted)
+	return nil
+}
+
+// Filter is a filter expression, eg. "status eq 'open' and age gt 3".
+//
+// Comparisons are of the form "<field> <op> <value>", where op is one of eq,
+// ne, gt, ge, lt, le or contains, and value is a single quoted string
+// (quotes within it are doubled), a number, true, false or null. Comparisons
+// may be combined with and, or, not and parentheses.
+type Filter struct {
+	// Parsed expression, or nil if the filter is empty.
+	Expr Expr
+}
+
+// ParseFilter parses a filter expression into an AST. An empty expression
+// returns a nil Expr.
+func ParseFilter(s string) (Expr, error) {
+	p := &filterParser{tokens: []filterToken{}}
+	if err := p.lex(s); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s in filter", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func (f *Filter) UnmarshalText(text []byte) error {
+	expr, err := ParseFilter(string(text))
+	if err != nil {
+		return err
+	}
+	f.Expr = expr
+	return nil
+}
+
+func (f Filter) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f Filter) String() string {
+	if f.Expr == nil {
+		return ""
+	}
+	return f.Expr.String()
+}
+
+// Match returns true if item matches the filter. An empty filter matches
+// everything.
+func (f Filter) Match(item interface{}) (bool, error) {
+	if f.Expr == nil {
+		return true, nil
+	}
+	return f.Expr.match(reflect.ValueOf(item))
+}
+
+// Expr is a node in a filter expression. Handlers can translate expressions
+// into their own query language with a type switch over *And, *Or, *Not and
+// *Comparison.
+type Expr interface {
+	String() string
+	match(v reflect.Value) (bool, error)
+}
+
+// And matches if both Left and Right match.
+type And struct {
+	Left, Right Expr
+}
+
+func (a *And) String() string {
+	return "(" + a.Left.String() + " and " + a.Right.String() + ")"
+}
+
+func (a *And) match(v reflect.Value) (bool, error) {
+	ok, err := a.Left.match(v)
+	if err != nil || !ok {
+		return false, err
+	}
+	return a.Right.match(v)
+}
+
+// Or matches if either Left or Right match.
+type Or struct {
+	Left, Right Expr
+}
+
+func (o *Or) String() string {
+	return "(" + o.Left.String() + " or " + o.Right.String() + ")"
+}
+
+func (o *Or) match(v reflect.Value) (bool, error) {
+	ok, err := o.Left.match(v)
+	if err != nil || ok {
+		return ok, err
+	}
+	return o.Right.match(v)
+}
+
+// Not matches if Expr does not match.
+type Not struct {
+	Expr Expr
+}
+
+func (n *Not) String() string {
+	return "not " + n.Expr.String()
+}
+
+func (n *Not) match(v reflect.Value) (bool, error) {
+	ok, err := n.Expr.match(v)
+	return !ok, err
+}
+
+// Comparison operators.
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpGt       = "gt"
+	OpGe       = "ge"
+	OpLt       = "lt"
+	OpLe       = "le"
+	OpContains = "contains"
+)
+
+var filterOps = map[string]bool{OpEq: true, OpNe: true, OpGt: true, OpGe: true, OpLt: true, OpLe: true, OpContains: true}
+
+// Comparison compares a field with a literal value. Value is a string,
+// float64, bool or nil.
+type Comparison struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+func (c *Comparison) String() string {
+	var value string
+	switch v := c.Value.(type) {
+	case nil:
+		value = "null"
+	case string:
+		value = "'" + strings.Replace(v, "'", "''", -1) + "'"
+	case float64:
+		value = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		value = fmt.Sprint(v)
+	}
+	return c.Field + " " + c.Op + " " + value
+}
+
+func (c *Comparison) match(v reflect.Value) (bool, error) {
+	field, err := lookupField(v, c.Field)
+	if err != nil {
+		return false, err
+	}
+	if c.Value == nil {
+		isNil := !field.IsValid()
+		switch c.Op {
+		case OpEq:
+			return isNil, nil
+		case OpNe:
+			return !isNil, nil
+		}
+		return false, fmt.Errorf("can't compare %s with null using %s", c.Field, c.Op)
+	}
+	if !field.IsValid() {
+		return c.Op == OpNe, nil
+	}
+	if c.Op == OpContains {
+		s, ok := c.Value.(string)
+		if !ok || field.Kind() != reflect.String {
+			return false, fmt.Errorf("%s contains requires a string field and value", c.Field)
+		}
+		return strings.Contains(field.String(), s), nil
+	}
+	cmp, err := compareLiteral(field, c.Value)
+	if err != nil {
+		return false, fmt.Errorf("can't compare %s: %s", c.Field, err)
+	}
+	switch c.Op {
+	case OpEq:
+		return cmp == 0, nil
+	case OpNe:
+		return cmp != 0, nil
+	case OpGt:
+		return cmp > 0, nil
+	case OpGe:
+		return cmp >= 0, nil
+	case OpLt:
+		return cmp < 0, nil
+	case OpLe:
+		return cmp <= 0, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", c.Op)
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Compare a field value with a literal from a filter expression.
+func compareLiteral(field reflect.Value, literal interface{}) (int, error) {
+	if field.Type() == timeType {
+		s, ok := literal.(string)
+		if !ok {
+			return 0, fmt.Errorf("expected a time string")
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return 0, err
+		}
+		return compareValues(field, reflect.ValueOf(t))
+	}
+	switch literal := literal.(type) {
+	case string:
+		if field.Kind() == reflect.String {
+			return strings.Compare(field.String(), literal), nil
+		}
+		if field.Type().Implements(textMarshalerType) {
+			text, err := field.Interface().(encoding.TextMarshaler).MarshalText()
+			return strings.Compare(string(text), literal), err
+		}
+	case float64:
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return compareFloats(float64(field.Int()), literal), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return compareFloats(float64(field.Uint()), literal), nil
+		case reflect.Float32, reflect.Float64:
+			return compareFloats(field.Float(), literal), nil
+		}
+	case bool:
+		if field.Kind() == reflect.Bool {
+			return compareValues(field, reflect.ValueOf(literal))
+		}
+	}
+	return 0, fmt.Errorf("%s is not comparable with %T", field.Type(), literal)
+}
+
+// Compare two field values of the same kind. Invalid (nil) values sort first.
+func compareValues(a, b reflect.Value) (int, error) {
+	switch {
+	case !a.IsValid() && !b.IsValid():
+		return 0, nil
+	case !a.IsValid():
+		return -1, nil
+	case !b.IsValid():
+		return 1, nil
+	}
+	if a.Type() == timeType && b.Type() == timeType {
+		at, bt := a.Interface().(time.Time), b.Interface().(time.Time)
+		switch {
+		case at.Before(bt):
+			return -1, nil
+		case at.After(bt):
+			return 1, nil
+		}
+		return 0, nil
+	}
+	switch a.Kind() {
+	case reflect.String:
+		if b.Kind() == reflect.String {
+			return strings.Compare(a.String(), b.String()), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if b.Kind() >= reflect.Int && b.Kind() <= reflect.Int64 {
+			return compareFloats(float64(a.Int()), float64(b.Int())), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if b.Kind() >= reflect.Uint && b.Kind() <= reflect.Uint64 {
+			return compareFloats(float64(a.Uint()), float64(b.Uint())), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if b.Kind() == reflect.Float32 || b.Kind() == reflect.Float64 {
+			return compareFloats(a.Float(), b.Float()), nil
+		}
+	case reflect.Bool:
+		if b.Kind() == reflect.Bool {
+			switch {
+			case a.Bool() == b.Bool():
+				return 0, nil
+			case b.Bool():
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, fmt.Errorf("can't compare %s with %s", a.Type(), b.Type())
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Resolve a dotted field path against v, matching struct fields by their
+// JSON name (case-insensitively) and maps by key. Returns an invalid Value if
+// a nil pointer is encountered along the path.
+func lookupField(v reflect.Value, path string) (reflect.Value, error) {
+	for _, name := range strings.Split(path, ".") {
+		v = indirectValue(v)
+		if !v.IsValid() {
+			return v, nil
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := structFieldByName(v, name)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("unknown field %q", path)
+			}
+			v = field
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, fmt.Errorf("unknown field %q", path)
+			}
+			v = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		default:
+			return reflect.Value{}, fmt.Errorf("unknown field %q", path)
+		}
+	}
+	return indirectValue(v), nil
+}
+
+// Dereference pointers and interfaces, returning an invalid Value for nil.
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// Find an exported struct field by its wire name, searching embedded structs.
+func structFieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			if embedded := indirectValue(v.Field(i)); embedded.Kind() == reflect.Struct {
+				if found, ok := structFieldByName(embedded, name); ok {
+					return found, true
+				}
+			}
+			continue
+		}
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		if strings.EqualFold(wireFieldName(field), name) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func isFieldPath(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if part == "" {
+			return false
+		}
+		for i, r := range part {
+			if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type filterTokenKind int
+
+const (
+	tokenIdent filterTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenLParen
+	tokenRParen
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	text  string
+	value interface{}
+}
+
+func (t filterToken) String() string {
+	if t.kind == tokenString {
+		return fmt.Sprintf("'%s'", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) lex(s string) error {
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			p.tokens = append(p.tokens, filterToken{kind: tokenLParen, text: "("})
+			i++
+		case r == ')':
+			p.tokens = append(p.tokens, filterToken{kind: tokenRParen, text: ")"})
+			i++
+		case r == '\'':
+			text := []rune{}
+			i++
+			for {
+				if i >= len(runes) {
+					return fmt.Errorf("unterminated string in filter")
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						text = append(text, '\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				text = append(text, runes[i])
+				i++
+			}
+			p.tokens = append(p.tokens, filterToken{kind: tokenString, text: string(text), value: string(text)})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE+-", runes[i])) {
+				i++
+			}
+			text := string(runes[start:i])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q in filter", text)
+			}
+			p.tokens = append(p.tokens, filterToken{kind: tokenNumber, text: text, value: value})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '.' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			p.tokens = append(p.tokens, filterToken{kind: tokenIdent, text: string(runes[start:i])})
+		default:
+			return fmt.Errorf("unexpected %q in filter", r)
+		}
+	}
+	return nil
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenIdent && strings.EqualFold(p.tokens[p.pos].text, keyword)
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, fmt.Errorf("unexpected end of filter")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token, nil
+}
+
+func (p *filterParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Expr, error) {
+	if p.peekKeyword("not") {
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{expr}, nil
+	}
+	token, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if token.kind == tokenLParen {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token, err := p.next(); err != nil || token.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ) in filter")
+		}
+		return expr, nil
+	}
+	if token.kind != tokenIdent || !isFieldPath(token.text) {
+		return nil, fmt.Errorf("expected field name but got %s in filter", token)
+	}
+	field := token.text
+	if token, err = p.next(); err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(token.text)
+	if token.kind != tokenIdent || !filterOps[op] {
+		return nil, fmt.Errorf("expected operator but got %s in filter", token)
+	}
+	if token, err = p.next(); err != nil {
+		return nil, err
+	}
+	comparison := &Comparison{Field: field, Op: op}
+	switch token.kind {
+	case tokenString, tokenNumber:
+		comparison.Value = token.value
+	case tokenIdent:
+		switch strings.ToLower(token.text) {
+		case "true":
+			comparison.Value = true
+		case "false":
+			comparison.Value = false
+		case "null":
+		default:
+			return nil, fmt.Errorf("expected value but got %s in filter", token)
+		}
+	default:
+		return nil, fmt.Errorf("expected value but got %s in filter", token)
+	}
+	return comparison, nil
+}
@@ -0,0 +1,290 @@
+package pathways
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type listOwner struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type listItem struct {
+	ID    int        `json:"id"`
+	Name  string     `json:"name"`
+	Score float64    `json:"score"`
+	Owner *listOwner `json:"owner"`
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected string
+		err      string
+	}{
+		// Precedence.
+		{filter: "a eq 1 or b eq 2 and c eq 3", expected: "(a eq 1 or (b eq 2 and c eq 3))"},
+		{filter: "a eq 1 and b eq 2 or c eq 3", expected: "((a eq 1 and b eq 2) or c eq 3)"},
+		{filter: "not a eq 1 and b eq 2", expected: "(not a eq 1 and b eq 2)"},
+		{filter: "not a eq 1 or b eq 2", expected: "(not a eq 1 or b eq 2)"},
+		{filter: "not (a eq 1 or b eq 2)", expected: "not (a eq 1 or b eq 2)"},
+		{filter: "not not a eq 1", expected: "not not a eq 1"},
+		{filter: "a eq 1 and (b eq 2 or c eq 3)", expected: "(a eq 1 and (b eq 2 or c eq 3))"},
+		{filter: "a eq 1 and b eq 2 and c eq 3", expected: "((a eq 1 and b eq 2) and c eq 3)"},
+		{filter: "A EQ 1 AND NOT b Gt 2", expected: "(A eq 1 and not b gt 2)"},
+		{filter: "((a eq 1))", expected: "a eq 1"},
+		// Strings.
+		{filter: "name eq 'it''s'", expected: "name eq 'it''s'"},
+		{filter: "name eq ''''", expected: "name eq ''''"},
+		{filter: "name eq ''", expected: "name eq ''"},
+		{filter: "name eq 'a and b'", expected: "name eq 'a and b'"},
+		{filter: "name eq 'héllo'", expected: "name eq 'héllo'"},
+		// Numbers.
+		{filter: "a gt -3", expected: "a gt -3"},
+		{filter: "a gt -0.5", expected: "a gt -0.5"},
+		{filter: "a lt 1e3", expected: "a lt 1000"},
+		{filter: "a lt 1.5E+2", expected: "a lt 150"},
+		{filter: "a lt 25e-1", expected: "a lt 2.5"},
+		{filter: "a lt -1e-2", expected: "a lt -0.01"},
+		{filter: "a lt 1e21", expected: "a lt 1e+21"},
+		// Literals.
+		{filter: "owner eq null", expected: "owner eq null"},
+		{filter: "owner ne NULL", expected: "owner ne null"},
+		{filter: "done eq true or done eq False", expected: "(done eq true or done eq false)"},
+		{filter: "owner.name contains 'x'", expected: "owner.name contains 'x'"},
+		{filter: "", expected: ""},
+		{filter: "   ", expected: ""},
+		// Errors.
+		{filter: "name eq 'open", err: "unterminated string in filter"},
+		{filter: "name eq 'it''", err: "unterminated string in filter"},
+		{filter: "a eq 1e", err: `invalid number "1e" in filter`},
+		{filter: "a eq 1-2", err: `invalid number "1-2" in filter`},
+		{filter: "a eq #", err: `unexpected '#' in filter`},
+		{filter: "a eq", err: "unexpected end of filter"},
+		{filter: "a", err: "unexpected end of filter"},
+		{filter: "not", err: "unexpected end of filter"},
+		{filter: "a eq 1 and", err: "unexpected end of filter"},
+		{filter: "a is 1", err: `expected operator but got "is" in filter`},
+		{filter: "a eq 'x' eq 1", err: `unexpected "eq" in filter`},
+		{filter: "a eq b", err: `expected value but got "b" in filter`},
+		{filter: "a eq (", err: `expected value but got "(" in filter`},
+		{filter: "'a' eq 1", err: `expected field name but got 'a' in filter`},
+		{filter: "a. eq 1", err: `expected field name but got "a." in filter`},
+		{filter: "(a eq 1", err: "expected ) in filter"},
+		{filter: "a eq 1)", err: `unexpected ")" in filter`},
+		{filter: "()", err: `expected field name but got ")" in filter`},
+	}
+	for _, test := range tests {
+		expr, err := ParseFilter(test.filter)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: expected error %q but got %v", test.filter, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.filter, err)
+			continue
+		}
+		if actual := (Filter{expr}).String(); actual != test.expected {
+			t.Errorf("%q: expected %s but got %s", test.filter, test.expected, actual)
+		}
+	}
+}
+
+func TestParseFilterAST(t *testing.T) {
+	expr, err := ParseFilter("not a eq -1.5e1 or b ne 'x''y' and c eq null")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Or{
+		Left: &Not{&Comparison{Field: "a", Op: OpEq, Value: -15.0}},
+		Right: &And{
+			Left:  &Comparison{Field: "b", Op: OpNe, Value: "x'y"},
+			Right: &Comparison{Field: "c", Op: OpEq, Value: nil},
+		},
+	}
+	if !reflect.DeepEqual(expr, expected) {
+		t.Errorf("expected %s but got %s", expected, expr)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	alice := &listOwner{Name: "alice", Email: "alice@example.com"}
+	items := []listItem{
+		{ID: 1, Name: "it's", Score: -2.5, Owner: alice},
+		{ID: 2, Name: "plain", Score: 1500},
+		{ID: 3, Name: "other", Score: 0.01, Owner: &listOwner{Name: "bob"}},
+	}
+	tests := []struct {
+		filter   string
+		expected []int
+		err      string
+	}{
+		{filter: "name eq 'it''s'", expected: []int{1}},
+		{filter: "score lt -1", expected: []int{1}},
+		{filter: "score ge -2.5 and score le -2.5", expected: []int{1}},
+		{filter: "score gt 1.2e3", expected: []int{2}},
+		{filter: "score eq 1e-2", expected: []int{3}},
+		{filter: "owner eq null", expected: []int{2}},
+		{filter: "owner ne null", expected: []int{1, 3}},
+		{filter: "owner.name eq null", expected: []int{2}},
+		{filter: "owner.name eq 'bob'", expected: []int{3}},
+		{filter: "owner.name ne 'bob'", expected: []int{1, 2}},
+		{filter: "owner.email contains 'example'", expected: []int{1}},
+		{filter: "not id eq 1 and id lt 3", expected: []int{2}},
+		{filter: "id eq 1 or id eq 2 and name eq 'other'", expected: []int{1}},
+		{filter: "(id eq 1 or id eq 2) and name eq 'plain'", expected: []int{2}},
+		{filter: "not (id eq 1 or id eq 2)", expected: []int{3}},
+		{filter: "score gt null", err: "can't compare score with null using gt"},
+		{filter: "name gt 1", err: "can't compare name: string is not comparable with float64"},
+		{filter: "id contains '1'", err: "id contains requires a string field and value"},
+		{filter: "missing eq 1", err: `unknown field "missing"`},
+		{filter: "name.first eq 'a'", err: `unknown field "name.first"`},
+	}
+	for _, test := range tests {
+		expr, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Fatalf("%q: %s", test.filter, err)
+		}
+		query := &ListQuery{Filter: Filter{expr}}
+		result, err := query.Apply(items)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: expected error %q but got %v", test.filter, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.filter, err)
+			continue
+		}
+		ids := []int{}
+		for _, item := range result.([]listItem) {
+			ids = append(ids, item.ID)
+		}
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%q: expected %v but got %v", test.filter, test.expected, ids)
+		}
+	}
+}
+
+func TestSortOrderSort(t *testing.T) {
+	items := func() []*listItem {
+		return []*listItem{
+			{ID: 1, Name: "b", Score: 2, Owner: &listOwner{Name: "carol"}},
+			{ID: 2, Name: "a", Score: 2},
+			{ID: 3, Name: "c", Score: 1, Owner: &listOwner{Name: "alice"}},
+			{ID: 4, Name: "a", Score: 3, Owner: &listOwner{Name: "carol"}},
+		}
+	}
+	tests := []struct {
+		sort     string
+		expected []int
+		err      string
+	}{
+		{sort: "name", expected: []int{2, 4, 1, 3}},
+		{sort: "-name", expected: []int{3, 1, 2, 4}},
+		{sort: "score,-id", expected: []int{3, 2, 1, 4}},
+		{sort: "+score, name", expected: []int{3, 2, 1, 4}},
+		// Missing owners sort first.
+		{sort: "owner.name", expected: []int{2, 3, 1, 4}},
+		{sort: "-owner.name,-score", expected: []int{4, 1, 3, 2}},
+		{sort: "OWNER.Name,id", expected: []int{2, 3, 1, 4}},
+		{sort: "", expected: []int{1, 2, 3, 4}},
+		{sort: "owner.missing", err: `unknown field "owner.missing"`},
+		{sort: "owner", err: "can't compare pathways.listOwner with pathways.listOwner"},
+	}
+	for _, test := range tests {
+		order, err := ParseSort(test.sort)
+		if err != nil {
+			t.Fatalf("%q: %s", test.sort, err)
+		}
+		sorted := items()
+		err = order.Sort(sorted)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: expected error %q but got %v", test.sort, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.sort, err)
+			continue
+		}
+		ids := []int{}
+		for _, item := range sorted {
+			ids = append(ids, item.ID)
+		}
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%q: expected %v but got %v", test.sort, test.expected, ids)
+		}
+	}
+}
+
+func TestParseSortErrors(t *testing.T) {
+	for _, sort := range []string{"-", "a..b", "1a", "-+a", "a b"} {
+		if _, err := ParseSort(sort); err == nil || !strings.HasPrefix(err.Error(), "invalid sort field") {
+			t.Errorf("%q: expected an invalid sort field error but got %v", sort, err)
+		}
+	}
+}
+
+func TestProjectNestedFields(t *testing.T) {
+	items := []listItem{
+		{ID: 1, Name: "a", Score: 1, Owner: &listOwner{Name: "alice", Email: "alice@example.com"}},
+		{ID: 2, Name: "b", Score: 2},
+	}
+	tests := []struct {
+		fields   string
+		expected interface{}
+	}{
+		{"name,owner.email", []interface{}{
+			map[string]interface{}{"name": "a", "owner": map[string]interface{}{"email": "alice@example.com"}},
+			map[string]interface{}{"name": "b", "owner": nil},
+		}},
+		{"owner", []interface{}{
+			map[string]interface{}{"owner": listOwner{Name: "alice", Email: "alice@example.com"}},
+			map[string]interface{}{"owner": nil},
+		}},
+		// A whole field subsumes its nested selections.
+		{"owner.name,owner", []interface{}{
+			map[string]interface{}{"owner": listOwner{Name: "alice", Email: "alice@example.com"}},
+			map[string]interface{}{"owner": nil},
+		}},
+		{"ID,Owner.Name", []interface{}{
+			map[string]interface{}{"id": 1, "owner": map[string]interface{}{"name": "alice"}},
+			map[string]interface{}{"id": 2, "owner": nil},
+		}},
+		{"owner.missing,missing", []interface{}{
+			map[string]interface{}{"owner": map[string]interface{}{}},
+			map[string]interface{}{"owner": nil},
+		}},
+	}
+	for _, test := range tests {
+		fields, err := ParseFields(test.fields)
+		if err != nil {
+			t.Fatalf("%q: %s", test.fields, err)
+		}
+		if actual := Project(items, fields); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%q: expected %#v but got %#v", test.fields, test.expected, actual)
+		}
+	}
+}
+
+func TestProjectMapOfItems(t *testing.T) {
+	items := map[string]*listItem{
+		"a": {ID: 1, Owner: &listOwner{Name: "alice", Email: "alice@example.com"}},
+		"b": {ID: 2},
+	}
+	fields, _ := ParseFields("owner.name")
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{"owner": map[string]interface{}{"name": "alice"}},
+		"b": map[string]interface{}{"owner": nil},
+	}
+	if actual := Project(items, fields); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v but got %#v", expected, actual)
+	}
+}
@@ -0,0 +1,84 @@
+package pathways
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// A Logger receives diagnostic messages. *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+func (r *Route) logger() Logger {
+	if r.service != nil {
+		return r.service.getLogger()
+	}
+	return log.Default()
+}
+
+func (s *Service) getLogger() Logger {
+	if s.logger != nil {
+		return s.logger
+	}
+	return log.Default()
+}
+
+// Recover from a panic in a route action, log it along with the stack trace,
+// and respond with a 500 APIError. In development mode the panic is
+// propagated after logging. If the response has already been started the
+// connection is aborted instead, so that the client does not mistake a
+// truncated response for a complete one.
+func (r *Route) recoverPanic(cx *Context) {
+	if err := recover(); err != nil {
+		r.handlePanic(cx, err)
+	}
+}
+
+func (r *Route) handlePanic(cx *Context, err interface{}) {
+	development := r.service != nil && r.service.development
+	handlePanic(r.logger(), development, fmt.Sprintf("route %q", r.name), cx, err)
+}
+
+// Recover from a panic in the default action, as for route actions.
+func (s *Service) recoverPanic(writer http.ResponseWriter, request *http.Request) {
+	if err := recover(); err != nil {
+		cx := &Context{
+			Request:     request,
+			Response:    writer,
+			RequestID:   RequestID(request),
+			serializers: s.serializers,
+		}
+		cx.status, _ = writer.(*statusWriter)
+		handlePanic(s.getLogger(), s.development, "default action", cx, err)
+	}
+}
+
+func handlePanic(logger Logger, development bool, source string, cx *Context, err interface{}) {
+	// http.ErrAbortHandler is used to deliberately abort a response.
+	if err == http.ErrAbortHandler {
+		panic(err)
+	}
+	logger.Printf("pathways: panic in %s (request %q): %v\n%s",
+		source, cx.RequestID, err, debug.Stack())
+	if development {
+		panic(err)
+	}
+	if responseStarted(cx) {
+		panic(http.ErrAbortHandler)
+	}
+	cx.APIError(http.StatusInternalServerError, "Internal Server Error").Write()
+}
+
+// Whether any of the response has been sent to the client. Output still
+// buffered by compression is discarded, as it can be replaced by an error.
+func responseStarted(cx *Context) bool {
+	if w, ok := cx.Response.(*compressWriter); ok && !w.decided {
+		w.status = 0
+		w.buf.Reset()
+		return false
+	}
+	return cx.status != nil && cx.status.status != 0
+}
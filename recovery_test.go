@@ -0,0 +1,110 @@
+package pathways
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type panickingFilter struct{}
+
+func (panickingFilter) String() string          { return "Panic()" }
+func (panickingFilter) Accept(cx *Context) bool { panic("filter failed") }
+
+func TestRecoverFilterPanic(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := NewService("/api").Logger(log.New(logs, "", 0))
+	s.Path("/items").Name("Filtered").Get().Filter(panickingFilter{}).APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, "filtered")
+	})
+	s.Path("/items").Name("Fallback").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, "fallback")
+	})
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/api/items", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 but got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "fallback") {
+		t.Errorf("later route responded after a filter panic: %s", w.Body.String())
+	}
+	if !strings.Contains(logs.String(), `panic in route "Filtered"`) || !strings.Contains(logs.String(), "filter failed") {
+		t.Errorf("panic was not logged: %s", logs.String())
+	}
+}
+
+func TestRecoverDefaultActionPanic(t *testing.T) {
+	logs := &bytes.Buffer{}
+	s := NewService("/api").Logger(log.New(logs, "", 0)).DefaultAction(func(cx *Context) *Response {
+		panic("default failed")
+	})
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/api/missing", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 but got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "panic in default action") || !strings.Contains(logs.String(), "default failed") {
+		t.Errorf("panic was not logged: %s", logs.String())
+	}
+}
+
+func TestRecoverFilterPanicInDevelopment(t *testing.T) {
+	s := NewService("/api").Logger(log.New(&bytes.Buffer{}, "", 0)).Development(true)
+	s.Path("/items").Get().Filter(panickingFilter{}).APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, "filtered")
+	})
+	defer func() {
+		if err := recover(); err != "filter failed" {
+			t.Errorf("expected the panic to propagate but got %v", err)
+		}
+	}()
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/items", nil))
+}
+
+func TestRecoverPanicAfterResponseStarted(t *testing.T) {
+	s := NewService("/api").Logger(log.New(&bytes.Buffer{}, "", 0))
+	s.Path("/partial").Get().Function(func(cx *Context) *Response {
+		return ResponseFromContext(cx, func(w http.ResponseWriter) {
+			w.Write([]byte("partial "))
+			panic("failed mid-response")
+		})
+	})
+	s.Path("/events").Get().APIFunction(func(cx *Context) *Response {
+		cx.Stream().Send(Event{Data: "first"})
+		panic("failed mid-stream")
+	})
+	for _, path := range []string{"/api/partial", "/api/events"} {
+		w := httptest.NewRecorder()
+		func() {
+			defer func() {
+				if err := recover(); err != http.ErrAbortHandler {
+					t.Errorf("%s: expected the response to be aborted but got %v", path, err)
+				}
+			}()
+			s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		}()
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Internal Server Error") {
+			t.Errorf("%s: error was appended to the response: %d %q", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRecoverPanicDiscardsBufferedResponse(t *testing.T) {
+	s := NewService("/api").Logger(log.New(&bytes.Buffer{}, "", 0)).Compression(CompressionOptions{MinSize: 1024})
+	s.Path("/partial").Get().Function(func(cx *Context) *Response {
+		return ResponseFromContext(cx, func(w http.ResponseWriter) {
+			w.Write([]byte("partial "))
+			panic("failed mid-response")
+		})
+	})
+	req := httptest.NewRequest("GET", "/api/partial", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("expected a clean 500 but got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,127 @@
+package pathways
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// A SerializerRegistry maps content types to Serializers. It is safe for
+// concurrent use: lookups are lock free, and registration replaces the
+// underlying map rather than mutating it.
+type SerializerRegistry struct {
+	lock        sync.Mutex
+	serializers atomic.Value // SerializerMap
+}
+
+// NewSerializerRegistry creates a registry containing a copy of serializers.
+func NewSerializerRegistry(serializers SerializerMap) *SerializerRegistry {
+	r := &SerializerRegistry{}
+	r.serializers.Store(serializers.clone())
+	return r
+}
+
+// Map returns an immutable snapshot of the registered serializers.
+func (r *SerializerRegistry) Map() SerializerMap {
+	return r.serializers.Load().(SerializerMap)
+}
+
+// Clone creates an independent copy of the registry.
+func (r *SerializerRegistry) Clone() *SerializerRegistry {
+	return NewSerializerRegistry(r.Map())
+}
+
+// Register a serializer for a content type, replacing any existing serializer.
+func (r *SerializerRegistry) Register(contentType string, serializer Serializer) *SerializerRegistry {
+	r.update(func(m SerializerMap) { m[contentType] = serializer })
+	return r
+}
+
+// Unregister the serializer for a content type.
+func (r *SerializerRegistry) Unregister(contentType string) *SerializerRegistry {
+	r.update(func(m SerializerMap) { delete(m, contentType) })
+	return r
+}
+
+func (r *SerializerRegistry) update(f func(m SerializerMap)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	m := r.Map().clone()
+	f(m)
+	r.serializers.Store(m)
+}
+
+// Lookup the serializer for a content type.
+func (r *SerializerRegistry) Lookup(contentType string) (Serializer, bool) {
+	ser, ok := r.Map()[contentType]
+	return ser, ok
+}
+
+// ContentTypes returns the sorted list of registered content types.
+func (r *SerializerRegistry) ContentTypes() []string {
+	types := []string{}
+	for ct := range r.Map() {
+		types = append(types, ct)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Serializers that can only decode requests implement this to be excluded
+// from response negotiation.
+type decodeOnlySerializer interface {
+	canEncode() bool
+}
+
+// Whether ct is registered with a serializer that can only decode.
+func (r *SerializerRegistry) decodeOnly(ct string) bool {
+	ser, ok := r.Map()[ct].(decodeOnlySerializer)
+	return ok && !ser.canEncode()
+}
+
+// Content types that responses can be encoded as.
+func (r *SerializerRegistry) responseContentTypes() []string {
+	types := []string{}
+	for _, ct := range r.ContentTypes() {
+		if !r.decodeOnly(ct) {
+			types = append(types, ct)
+		}
+	}
+	return types
+}
+
+func (r *SerializerRegistry) DecodeRequest(req *http.Request, contentType string, v interface{}) error {
+	return r.Map().DecodeRequest(req, contentType, v)
+}
+
+// DecodeRequestStrict decodes the request body, rejecting unknown fields and
+// trailing data if the serializer supports it.
+func (r *SerializerRegistry) DecodeRequestStrict(req *http.Request, contentType string, v interface{}) error {
+	return r.Map().DecodeRequestStrict(req, contentType, v)
+}
+
+func (r *SerializerRegistry) DecodeStrict(ct string, reader io.Reader, v interface{}) error {
+	return r.Map().DecodeStrict(ct, reader, v)
+}
+
+func (r *SerializerRegistry) Decode(ct string, reader io.Reader, v interface{}) error {
+	return r.Map().Decode(ct, reader, v)
+}
+
+func (r *SerializerRegistry) EncodeResponse(w http.ResponseWriter, code int, contentType string, response interface{}) error {
+	return r.Map().EncodeResponse(w, code, contentType, response)
+}
+
+func (r *SerializerRegistry) Encode(ct string, w io.Writer, v interface{}) error {
+	return r.Map().Encode(ct, w, v)
+}
+
+func (s SerializerMap) clone() SerializerMap {
+	out := make(SerializerMap, len(s))
+	for ct, ser := range s {
+		out[ct] = ser
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package pathways
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// Maximum length of a client supplied request ID.
+const maxRequestIDLength = 128
+
+// Ensure the request has an ID, accepting a well formed X-Request-ID header
+// from the client or generating a new one. The ID is echoed in the response.
+func withRequestID(w http.ResponseWriter, request *http.Request) *http.Request {
+	id := request.Header.Get(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	w.Header().Set(requestIDHeader, id)
+	return request.WithContext(context.WithValue(request.Context(), requestIDKey{}, id))
+}
+
+// RequestID returns the ID assigned to request by Service.ServeHTTP, falling
+// back to the X-Request-ID header.
+func RequestID(request *http.Request) string {
+	if id, ok := request.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return request.Header.Get(requestIDHeader)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
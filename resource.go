@@ -0,0 +1,189 @@
+package pathways
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store when an item does not exist.
+var ErrNotFound = errors.New("not found")
+
+// A Store persists the items of a resource.
+type Store interface {
+	// List all items, keyed by ID.
+	List() (map[string]interface{}, error)
+	// Get an item by ID, or ErrNotFound.
+	Get(id string) (interface{}, error)
+	// Create a new item, returning its ID.
+	Create(item interface{}) (string, error)
+	// Replace an existing item, or return ErrNotFound.
+	Replace(id string, item interface{}) error
+	// Delete an item, or return ErrNotFound.
+	Delete(id string) error
+}
+
+// Resource registers conventional CRUD routes for the items in store. item
+// is a pointer to a structure used as the request and response type, eg.
+//
+//	s.Resource("/kv", pathways.NewMemoryStore(), &Item{})
+//
+// registers:
+//
+//	List     GET    /kv/       200 with all items keyed by ID
+//	Create   POST   /kv/       201 with the item and a Location header
+//	Get      GET    /kv/{id}   200 with the item
+//	Replace  PUT    /kv/{id}   200 with the item
+//	Patch    PATCH  /kv/{id}   200 with the stored item after patching
+//	Delete   DELETE /kv/{id}   204
+//
+// Requests for items that do not exist result in a 404. To register more than
+// one resource on a service, use NamedResource.
+func (s *Service) Resource(path string, store Store, item interface{}) *Service {
+	return s.NamedResource("", path, store, item)
+}
+
+// NamedResource registers resource routes like Resource, with route names
+// prefixed by prefix, eg. "UserList" and "UserGet" for the prefix "User".
+// Panics if a route with any of the names is already registered.
+func (s *Service) NamedResource(prefix, path string, store Store, item interface{}) *Service {
+	if reflect.TypeOf(item).Kind() != reflect.Ptr {
+		panic("resource item must be a pointer")
+	}
+	for _, name := range []string{"List", "Create", "Get", "Replace", "Patch", "Delete"} {
+		if s.Find(prefix+name) != nil {
+			panic(fmt.Sprintf("a route named %q is already registered", prefix+name))
+		}
+	}
+	collection := path + "/"
+	element := path + "/{id}"
+	list := map[string]interface{}{}
+	var get *Route
+
+	s.Path(collection).Name(prefix + "List").Get().APIResponseType(list).
+		APIFunction(func(cx *Context) *Response {
+			items, err := store.List()
+			if err != nil {
+				return storeError(cx, err)
+			}
+			return cx.APIResponse(http.StatusOK, items)
+		})
+
+	s.Path(collection).Name(prefix + "Create").Post().APIRequestType(item).APIResponseType(item).
+		APIFunction(func(cx *Context, item interface{}) *Response {
+			id, err := store.Create(item)
+			if err != nil {
+				return storeError(cx, err)
+			}
+			location := get.Reverse(map[string]string{"id": id})
+			return cx.APIResponse(http.StatusCreated, item).Location(location)
+		})
+
+	get = s.Path(element).Name(prefix + "Get").Get().APIResponseType(item).
+		APIFunction(func(cx *Context) *Response {
+			item, err := store.Get(cx.PathVars["id"])
+			if err != nil {
+				return storeError(cx, err)
+			}
+			return cx.APIResponse(http.StatusOK, item)
+		})
+
+	replace := func(cx *Context, item interface{}) *Response {
+		if err := store.Replace(cx.PathVars["id"], item); err != nil {
+			return storeError(cx, err)
+		}
+		return cx.APIResponse(http.StatusOK, item)
+	}
+	s.Path(element).Name(prefix + "Replace").Put().APIRequestType(item).APIResponseType(item).
+		APIFunction(replace)
+
+	s.Path(element).Name(prefix + "Patch").Patch().APIRequestType(item).APIResponseType(item).
+		Current(func(cx *Context) (interface{}, error) {
+			item, err := store.Get(cx.PathVars["id"])
+			if err == ErrNotFound {
+				return nil, nil
+			}
+			return item, err
+		}).
+		APIFunction(replace)
+
+	s.Path(element).Name(prefix + "Delete").Delete().
+		APIFunction(func(cx *Context) *Response {
+			if err := store.Delete(cx.PathVars["id"]); err != nil {
+				return storeError(cx, err)
+			}
+			return cx.Status(http.StatusNoContent)
+		})
+	return s
+}
+
+func storeError(cx *Context, err error) *Response {
+	if err == ErrNotFound {
+		return cx.APIError(http.StatusNotFound, "Not Found")
+	}
+	return cx.APIError(http.StatusInternalServerError, err.Error())
+}
+
+// MemoryStore is an in-memory Store, assigning sequential IDs to created
+// items.
+type MemoryStore struct {
+	lock   sync.RWMutex
+	items  map[string]interface{}
+	nextID int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]interface{}{}, nextID: 1}
+}
+
+func (m *MemoryStore) List() (map[string]interface{}, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	items := make(map[string]interface{}, len(m.items))
+	for id, item := range m.items {
+		items[id] = item
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) Get(id string) (interface{}, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	item, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return item, nil
+}
+
+func (m *MemoryStore) Create(item interface{}) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	id := strconv.Itoa(m.nextID)
+	m.nextID++
+	m.items[id] = item
+	return id, nil
+}
+
+func (m *MemoryStore) Replace(id string, item interface{}) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.items[id]; !ok {
+		return ErrNotFound
+	}
+	m.items[id] = item
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.items[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.items, id)
+	return nil
+}
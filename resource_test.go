@@ -0,0 +1,85 @@
+package pathways
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type resourceItem struct {
+	Name string
+}
+
+func TestNamedResourcesAreIndependent(t *testing.T) {
+	s := NewService("/api")
+	s.NamedResource("A", "/a", NewMemoryStore(), &resourceItem{})
+	s.NamedResource("B", "/b", NewMemoryStore(), &resourceItem{})
+
+	req := httptest.NewRequest("POST", "/api/b/", strings.NewReader(`{"Name":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 but got %d: %s", w.Code, w.Body)
+	}
+	if location := w.Header().Get("Location"); location != "/api/b/1" {
+		t.Fatalf("expected Location /api/b/1 but got %q", location)
+	}
+	if path := s.Find("BGet").Reverse(map[string]string{"id": "1"}); path != "/api/b/1" {
+		t.Fatalf("unexpected BGet path %q", path)
+	}
+}
+
+func TestResourceRejectsDuplicateNames(t *testing.T) {
+	s := NewService("/api").Resource("/a", NewMemoryStore(), &resourceItem{})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic registering a second unnamed resource")
+		}
+	}()
+	s.Resource("/b", NewMemoryStore(), &resourceItem{})
+}
+
+func TestResourcePatchKeepsOmittedFields(t *testing.T) {
+	type ownedItem struct {
+		Name  string
+		Owner string
+	}
+	s := NewService("/api")
+	s.Resource("/items", NewMemoryStore(), &ownedItem{})
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	if w := do("POST", "/api/items/", "application/json", `{"Name":"a","Owner":"bob"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 but got %d: %s", w.Code, w.Body)
+	}
+	tests := []struct {
+		contentType string
+		body        string
+		expected    string
+	}{
+		{MergePatchContentType, `{"Name":"b"}`, `{"Name":"b","Owner":"bob"}`},
+		{JSONPatchContentType, `[{"op":"replace","path":"/Name","value":"c"}]`, `{"Name":"c","Owner":"bob"}`},
+	}
+	for _, test := range tests {
+		if w := do("PATCH", "/api/items/1", test.contentType, test.body); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != test.expected {
+			t.Fatalf("%s: expected 200 %s but got %d %s", test.contentType, test.expected, w.Code, w.Body)
+		}
+		if w := do("GET", "/api/items/1", "", ""); strings.TrimSpace(w.Body.String()) != test.expected {
+			t.Fatalf("%s: expected the stored item to be %s but got %s", test.contentType, test.expected, w.Body)
+		}
+	}
+	if w := do("PATCH", "/api/items/1", "application/json", `{"Name":"d"}`); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 but got %d: %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/api/items/1", "", ""); strings.TrimSpace(w.Body.String()) != `{"Name":"c","Owner":"bob"}` {
+		t.Fatalf("a rejected patch modified the item: %s", w.Body)
+	}
+}
@@ -2,6 +2,9 @@ package pathways
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ResponseWriter func(http.ResponseWriter)
@@ -28,6 +31,23 @@ func (r *Response) Location(url string) *Response {
 	return r.Header("Location", url)
 }
 
+// ETag sets the entity tag of the response, overriding the tag generated from
+// the encoded response. The tag is quoted if necessary.
+func (r *Response) ETag(tag string) *Response {
+	if !strings.HasPrefix(tag, `"`) && !strings.HasPrefix(tag, `W/"`) {
+		tag = strconv.Quote(tag)
+	}
+	r.Response.Header().Set("ETag", tag)
+	return r
+}
+
+// LastModified sets the Last-Modified header, allowing conditional requests
+// with If-Modified-Since.
+func (r *Response) LastModified(t time.Time) *Response {
+	r.Response.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	return r
+}
+
 func (r *Response) Header(key, value string) *Response {
 	r.Response.Header().Add(key, value)
 	return r
@@ -36,3 +56,46 @@ func (r *Response) Header(key, value string) *Response {
 func (r *Response) Write() {
 	r.writer(r.Response)
 }
+
+// statusWriter records the status code and number of bytes written through
+// an http.ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Status code written, defaulting to 200 if nothing has been written.
+func (s *statusWriter) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
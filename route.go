@@ -3,9 +3,13 @@ package pathways
 import (
 	"fmt"
 	"html/template"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Service struct {
@@ -13,6 +17,18 @@ type Service struct {
 	routes        []*Route
 	defaultAction http.Handler
 	templateRoot  string
+	logger        Logger
+	development   bool
+	accessLog     *slog.Logger
+	metrics       *metrics
+	exporter      SpanExporter
+	serializers   *SerializerRegistry
+	strict        bool
+	maxBodySize   int64
+	compression   *CompressionOptions
+	cursorKey     []byte
+	cursorOnce    sync.Once
+	envelope      Envelope
 }
 
 func NewService(root string) *Service {
@@ -20,6 +36,7 @@ func NewService(root string) *Service {
 	return &Service{
 		root:          root,
 		defaultAction: (http.HandlerFunc)(http.NotFound),
+		metrics:       newMetrics(),
 	}
 }
 
@@ -28,6 +45,33 @@ func (s *Service) TemplateRoot(path string) *Service {
 	return s
 }
 
+// Logger to use for diagnostic messages, such as recovered panics. Defaults
+// to the standard library logger.
+func (s *Service) Logger(logger Logger) *Service {
+	s.logger = logger
+	return s
+}
+
+// Development mode re-panics after a handler panic has been logged, rather
+// than responding with a 500.
+func (s *Service) Development(development bool) *Service {
+	s.development = development
+	return s
+}
+
+// Serializers used by this service, rather than the global Serializers.
+func (s *Service) Serializers(serializers *SerializerRegistry) *Service {
+	s.serializers = serializers
+	return s
+}
+
+func (s *Service) serializerRegistry() *SerializerRegistry {
+	if s != nil && s.serializers != nil {
+		return s.serializers
+	}
+	return Serializers
+}
+
 func (s *Service) DefaultHandler(action http.Handler) *Service {
 	s.defaultAction = action
 	return s
@@ -40,18 +84,35 @@ func (s *Service) DefaultAction(action RouteAction) *Service {
 }
 
 func (s *Service) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	start := time.Now()
+	w := &statusWriter{ResponseWriter: writer}
+	request = withRequestID(w, request)
+	route := s.dispatch(w, request)
+	duration := time.Since(start)
+	s.metrics.observe(metricsKey(route, request), w.Status(), duration)
+	if s.accessLog != nil {
+		s.logAccess(route, w, request, duration)
+	}
+}
+
+// Dispatch the request to the first matching route, returning it. If no
+// route matches the default action is applied and nil is returned.
+func (s *Service) dispatch(writer http.ResponseWriter, request *http.Request) *Route {
 	for _, route := range s.routes {
 		if route.apply(writer, request) {
-			return
+			return route
 		}
 	}
+	defer s.recoverPanic(writer, request)
 	s.defaultAction.ServeHTTP(writer, request)
+	return nil
 }
 
 func (s *Service) Path(path string) *Route {
 	path = strings.TrimLeft(path, "/")
 	route := NewRoute(s.root + path)
 	route.templateRoot = s.templateRoot
+	route.service = s
 	s.routes = append(s.routes, route)
 	return route
 }
@@ -66,6 +127,7 @@ func (s *Service) Find(name string) *Route {
 }
 
 type Route struct {
+	service      *Service
 	name         string
 	path         string
 	filters      []StageAcceptor
@@ -76,6 +138,13 @@ type Route struct {
 	responseType interface{}
 	templateRoot string
 	template     *template.Template
+	strict       bool
+	maxBodySize  int64
+	version      VersionFunc
+	current      CurrentFunc
+	sparseFields bool
+	envelope     Envelope
+	patch        bool
 }
 
 func NewRoute(path string) *Route {
@@ -101,19 +170,70 @@ func (r *Route) String() string {
 }
 
 func (r *Route) apply(writer http.ResponseWriter, request *http.Request) bool {
+	status, ok := writer.(*statusWriter)
+	if !ok {
+		status = &statusWriter{ResponseWriter: writer}
+		writer = status
+	}
 	cx := &Context{
-		Request:  request,
-		Response: writer,
-		Vars:     make(map[string]interface{}),
-		Template: r.template,
+		Request:   request,
+		Response:  writer,
+		Vars:      make(map[string]interface{}),
+		Template:  r.template,
+		RequestID: RequestID(request),
+		route:     r,
+		status:    status,
+	}
+	if r.service != nil {
+		cx.serializers = r.service.serializers
 	}
+	cx.strict = r.isStrict()
+	if accepted, recovered := r.accept(cx); !accepted {
+		// A panicking filter has already responded, so no other route may.
+		return recovered
+	}
+	r.serve(cx)
+	return true
+}
+
+// Evaluate the route's filters, recovering from any panic as for the action.
+func (r *Route) accept(cx *Context) (accepted bool, recovered bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			r.handlePanic(cx, err)
+			accepted, recovered = false, true
+		}
+	}()
 	for _, filter := range r.filters {
 		if !filter.Accept(cx) {
-			return false
+			return false, false
 		}
 	}
+	return true, false
+}
+
+func (r *Route) serve(cx *Context) {
+	if r.service != nil {
+		key := metricsKey(r, cx.Request)
+		r.service.metrics.begin(key)
+		defer r.service.metrics.end(key)
+	}
+	span := r.startSpan(cx)
+	defer r.finishSpan(cx, span)
+	if w := r.compressResponse(cx); w != nil {
+		defer w.Close()
+	}
+	defer cx.stopStream()
+	defer r.recoverPanic(cx)
+	if response := r.limitBody(cx); response != nil {
+		response.Write()
+		return
+	}
+	if response := r.checkPreconditions(cx); response != nil {
+		response.Write()
+		return
+	}
 	r.action(cx).Write()
-	return true
 }
 
 func (r *Route) Template(filename string) *Route {
@@ -199,9 +319,18 @@ func (r *Route) APIResponseType(t interface{}) *Route {
 
 // APIFunction handles this route with a function of the form func(*Context[,
 // t]). If t is provided by APIRequestType(), it must be a pointer to a
-// structure. The request body will be decoded into a value of this type and
-// passed to the callback as the second argument. If t is nil, the request
-// body is not decoded, and no argument is passed.
+// structure. The request body, if any, will be decoded into a value of this
+// type and passed to the callback as the second argument. If t is nil, the
+// request body is not decoded, and no argument is passed.
+//
+// Fields of t tagged with `path:"name"`, `query:"name"` or `header:"Name"`
+// are populated from path variables, query parameters and headers
+// respectively, eg.
+//
+//	type ListRequest struct {
+//		Limit  int    `query:"limit"`
+//		Tenant string `header:"X-Tenant"`
+//	}
 func (r *Route) APIFunction(f interface{}) *Route {
 	return r.Action(applyAPIFunction(f, r.requestType))
 }
@@ -221,11 +350,20 @@ func (r *Route) Method() string {
 	return r.methodMatch[0]
 }
 
-// Reverse the route path.
+// Reverse the route path. Values are path escaped, except for the "/"
+// separators of remainder variables ({arg...}).
 func (r *Route) Reverse(args map[string]string) string {
 	path := r.path
 	for arg, value := range args {
-		// TODO: Handle remainder {arg...}
+		if strings.HasSuffix(arg, "...") {
+			segments := strings.Split(value, "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			value = strings.Join(segments, "/")
+		} else {
+			value = url.PathEscape(value)
+		}
 		path = strings.Replace(path, "{"+arg+"}", value, 1)
 	}
 	return path
@@ -1,6 +1,7 @@
 package pathways
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"github.com/vmihailenco/msgpack"
@@ -8,63 +9,178 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"sync"
 )
 
 var (
-	Serializers = SerializerMap{
-		"application/json":      &JsonSerializer{},
-		"application/x-msgpack": &MsgpackSerializer{},
-		"application/bson":      &BsonSerializer{},
-	}
+	// Default serializers, used by any Service or Client without its own
+	// registry.
+	Serializers = NewSerializerRegistry(SerializerMap{
+		"application/json":                  &JsonSerializer{},
+		HALContentType:                      &JsonSerializer{},
+		JSONAPIContentType:                  &JsonSerializer{},
+		"application/x-msgpack":             &MsgpackSerializer{},
+		"application/bson":                  &BsonSerializer{},
+		"application/cbor":                  &CBORSerializer{},
+		"application/x-protobuf":            &ProtobufSerializer{},
+		"application/x-www-form-urlencoded": &FormSerializer{},
+		"multipart/form-data":               &FormSerializer{Multipart: true},
+		"application/xml":                   &XMLSerializer{},
+		"text/xml":                          &XMLSerializer{},
+	})
 	UnsupportedContentType = errors.New("unsupported content type")
 )
 
 type SerializerMap map[string]Serializer
 
 func (s SerializerMap) DecodeRequest(req *http.Request, contentType string, v interface{}) error {
-	return s.Decode(contentType, req.Body, v)
+	return s.decodeRequest(req, contentType, v, false)
+}
+
+func (s SerializerMap) decodeRequest(req *http.Request, contentType string, v interface{}, strict bool) error {
+	if ser, ok := s[contentType].(RequestDecoder); ok {
+		err := ser.DecodeRequest(req, v)
+		if err != nil {
+			serializerErrors.inc("decode", contentType)
+		}
+		return err
+	}
+	return s.decode(contentType, req.Body, v, strict)
 }
 
 func (s SerializerMap) Decode(ct string, r io.Reader, v interface{}) error {
+	return s.decode(ct, r, v, false)
+}
+
+func (s SerializerMap) decode(ct string, r io.Reader, v interface{}, strict bool) error {
 	if ser, ok := s[ct]; ok {
 		decoder := ser.NewDecoder(r)
-		return decoder.Decode(v)
+		if strictSer, ok := ser.(StrictSerializer); ok && strict {
+			decoder = strictSer.NewStrictDecoder(r)
+		}
+		err := decoder.Decode(v)
+		if err != nil {
+			serializerErrors.inc("decode", ct)
+		}
+		return err
 	}
+	serializerErrors.inc("decode", unsupportedContentTypeLabel)
 	return UnsupportedContentType
 }
 
 type APIError struct {
-	Status int
-	Error  string
+	Status    int
+	Error     string
+	RequestID string `json:",omitempty" msgpack:",omitempty" xml:",omitempty"`
+	// Fields that failed validation, if any.
+	Fields []FieldError `json:",omitempty" xml:",omitempty"`
 }
 
+// EncodeResponse encodes response into a buffer before writing it, so that
+// encoding errors can be reported to the client as a 500 rather than a
+// truncated body.
 func (s SerializerMap) EncodeResponse(w http.ResponseWriter, code int, contentType string, response interface{}) error {
-	// TODO: Figure out ordering here that isn't shit.
-	if ser, ok := s[contentType]; ok {
-		w.Header().Set("Content-Type", contentType)
-		w.WriteHeader(code)
-		s.rawEncode(ser, w, response)
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		ser := s["application/json"]
+	return s.encodeResponse(w, code, contentType, response, writeBuffer)
+}
+
+// A function that writes an encoded response.
+type bufferWriter func(w http.ResponseWriter, code int, contentType string, buf *bytes.Buffer)
+
+func (s SerializerMap) encodeResponse(w http.ResponseWriter, code int, contentType string, response interface{}, write bufferWriter) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	ser, ok := s[contentType]
+	if !ok {
+		serializerErrors.inc("encode", unsupportedContentTypeLabel)
 		err := "Invalid content type " + contentType
-		s.rawEncode(ser, w, &APIError{
-			Status: code,
-			Error:  err,
+		s.rawEncode(s.jsonSerializer(), buf, &APIError{
+			Status:    http.StatusNotAcceptable,
+			Error:     err,
+			RequestID: w.Header().Get(requestIDHeader),
 		})
+		writeBuffer(w, http.StatusNotAcceptable, "application/json", buf)
 		return errors.New(err)
 	}
+	if err := s.rawEncode(ser, buf, response); err != nil {
+		if apiError, ok := response.(*APIError); ok {
+			// Some formats, such as protobuf, can't encode an APIError, so
+			// respond with JSON rather than losing the status.
+			buf.Reset()
+			if s.rawEncode(s.jsonSerializer(), buf, apiError) == nil {
+				writeBuffer(w, code, "application/json", buf)
+				return nil
+			}
+		}
+		serializerErrors.inc("encode", contentType)
+		buf.Reset()
+		internalError := &APIError{
+			Status:    http.StatusInternalServerError,
+			Error:     "Internal Server Error",
+			RequestID: w.Header().Get(requestIDHeader),
+		}
+		if s.rawEncode(ser, buf, internalError) != nil {
+			buf.Reset()
+			contentType = "application/json"
+			if s.rawEncode(s.jsonSerializer(), buf, internalError) != nil {
+				buf.Reset()
+				buf.WriteString("Internal Server Error\n")
+				contentType = "text/plain; charset=utf-8"
+			}
+		}
+		writeBuffer(w, http.StatusInternalServerError, contentType, buf)
+		return err
+	}
+	write(w, code, contentType, buf)
 	return nil
 }
 
+func writeBuffer(w http.ResponseWriter, code int, contentType string, buf *bytes.Buffer) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
+
+// Buffers larger than this are not returned to the pool.
+const maxPooledBufferSize = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return &bytes.Buffer{} },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
 func (s SerializerMap) Encode(ct string, w io.Writer, v interface{}) error {
 	if ser, ok := s[ct]; ok {
-		return s.rawEncode(ser, w, v)
+		err := s.rawEncode(ser, w, v)
+		if err != nil {
+			serializerErrors.inc("encode", ct)
+		}
+		return err
 	}
+	serializerErrors.inc("encode", unsupportedContentTypeLabel)
 	return UnsupportedContentType
 }
 
+// Serializer used for errors that can't be encoded in the negotiated format.
+func (s SerializerMap) jsonSerializer() Serializer {
+	if ser, ok := s["application/json"]; ok {
+		return ser
+	}
+	return &JsonSerializer{}
+}
+
 func (s SerializerMap) rawEncode(ser Serializer, w io.Writer, v interface{}) error {
 	encoder := ser.NewEncoder(w)
 	return encoder.Encode(v)
@@ -83,14 +199,16 @@ type Serializer interface {
 	NewDecoder(r io.Reader) ContentTypeDecoder
 }
 
+// JsonSerializer encodes and decodes JSON. proto.Message values are handled
+// with protojson.
 type JsonSerializer struct{}
 
 func (j *JsonSerializer) NewEncoder(w io.Writer) ContentTypeEncoder {
-	return json.NewEncoder(w)
+	return &jsonEncoder{w, json.NewEncoder(w)}
 }
 
 func (j *JsonSerializer) NewDecoder(r io.Reader) ContentTypeDecoder {
-	return json.NewDecoder(r)
+	return &jsonDecoder{decoder: json.NewDecoder(r)}
 }
 
 type MsgpackSerializer struct{}
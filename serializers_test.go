@@ -0,0 +1,79 @@
+package pathways
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnacceptableContentType(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/ok").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, "ok")
+	})
+	req := httptest.NewRequest("GET", "/api/ok", nil)
+	req.Header.Set("Accept", "image/png")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected 406 but got %d: %s", w.Code, w.Body.String())
+	}
+	apiError := &APIError{}
+	if err := json.Unmarshal(w.Body.Bytes(), apiError); err != nil {
+		t.Fatal(err)
+	}
+	if apiError.Status != http.StatusNotAcceptable || apiError.Error != "Invalid content type image/png" {
+		t.Errorf("unexpected error %+v", apiError)
+	}
+}
+
+func TestNegotiatedContentType(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/ok").Get().APIFunction(func(cx *Context) *Response {
+		return cx.APIResponse(http.StatusOK, "ok")
+	})
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/x-msgpack", "application/x-msgpack"},
+		{"application/json;q=0.5, application/cbor", "application/cbor"},
+		{"image/png, application/xml;q=0.1", "application/xml"},
+		{"application/*", "application/json"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/api/ok", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != test.expected {
+			t.Errorf("Accept %q: expected 200 %s but got %d %s", test.accept, test.expected, w.Code, ct)
+		}
+	}
+}
+
+func TestAPIErrorOmitsEmptyRequestID(t *testing.T) {
+	for _, ct := range []string{"application/json", "application/x-msgpack", "application/xml"} {
+		w := &bytes.Buffer{}
+		if err := Serializers.Encode(ct, w, &APIError{Status: http.StatusNotFound, Error: "Not Found"}); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(w.Bytes(), []byte("RequestID")) {
+			t.Errorf("%s: expected an empty RequestID to be omitted but got %q", ct, w.String())
+		}
+		w.Reset()
+		if err := Serializers.Encode(ct, w, &APIError{Status: http.StatusNotFound, Error: "Not Found", RequestID: "abc"}); err != nil {
+			t.Fatal(err)
+		}
+		decoded := &APIError{}
+		if err := Serializers.Decode(ct, w, decoded); err != nil || decoded.RequestID != "abc" {
+			t.Errorf("%s: expected the RequestID to round trip but got %+v (%v)", ct, decoded, err)
+		}
+	}
+}
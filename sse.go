@@ -0,0 +1,474 @@
+package pathways
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventStreamContentType is the media type of Server-Sent Events.
+const EventStreamContentType = "text/event-stream"
+
+// DefaultHeartbeat is the interval between comments sent to keep idle event
+// streams open through proxies.
+const DefaultHeartbeat = 15 * time.Second
+
+// Header carrying the content type of event data. Data in non-textual
+// formats, such as msgpack, is base64 encoded.
+const eventContentTypeHeader = "X-Event-Content-Type"
+
+// Event is a Server-Sent Event.
+type Event struct {
+	// ID of the event, sent back by clients as Last-Event-ID when they
+	// reconnect.
+	ID string
+	// Event type. Defaults to "message".
+	Type string
+	// Data is encoded with the serializer negotiated for the request.
+	Data interface{}
+	// Reconnection delay to request of the client, if non-zero.
+	Retry time.Duration
+}
+
+// EventStream is a Server-Sent Events response created by Context.Stream.
+type EventStream struct {
+	cx          *Context
+	contentType string
+	lock        sync.Mutex
+	stopped     bool
+	heartbeat   chan struct{}
+}
+
+// Stream starts a Server-Sent Events response. The handler sends events
+// until the client disconnects, which closes Done(), and then returns
+// End(), eg.
+//
+//	stream := cx.Stream()
+//	for {
+//		select {
+//		case <-stream.Done():
+//			return stream.End()
+//		case item := <-updates:
+//			if err := stream.Send(pathways.Event{ID: item.ID, Data: item}); err != nil {
+//				return stream.End()
+//			}
+//		}
+//	}
+//
+// Event data is encoded with the serializer negotiated from the Accept
+// header, eg. "text/event-stream, application/x-msgpack".
+func (c *Context) Stream() *EventStream {
+	s := &EventStream{
+		cx:          c,
+		contentType: c.eventContentType(),
+	}
+	c.stream = s
+	header := c.Response.Header()
+	header.Set("Content-Type", EventStreamContentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set(eventContentTypeHeader, s.contentType)
+	header.Del("Content-Length")
+	c.Response.WriteHeader(http.StatusOK)
+	s.flush()
+	return s.Heartbeat(DefaultHeartbeat)
+}
+
+// Negotiate the serializer for event data from the Accept header, ignoring
+// text/event-stream itself, which is all that browsers send.
+func (c *Context) eventContentType() string {
+	ranges := []acceptRange{}
+	for _, r := range parseAccept(c.Request.Header.Get("Accept")) {
+		if r.mediaType != EventStreamContentType {
+			ranges = append(ranges, r)
+		}
+	}
+	serializers := c.Serializers()
+	contentType := negotiateContentType(ranges, serializers.responseContentTypes(), "application/json")
+	if _, ok := serializers.Lookup(contentType); !ok {
+		return "application/json"
+	}
+	return contentType
+}
+
+// LastEventID returns the ID of the last event received by a reconnecting
+// client, from which the stream should be resumed.
+func (s *EventStream) LastEventID() string {
+	return s.cx.Request.Header.Get("Last-Event-ID")
+}
+
+// Done is closed when the client disconnects.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.cx.Request.Context().Done()
+}
+
+// Heartbeat sets the interval between keep-alive comments. An interval of
+// zero disables them.
+func (s *EventStream) Heartbeat(interval time.Duration) *EventStream {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.heartbeat != nil {
+		close(s.heartbeat)
+		s.heartbeat = nil
+	}
+	if interval <= 0 || s.stopped {
+		return s
+	}
+	stop := make(chan struct{})
+	s.heartbeat = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-s.Done():
+				return
+			case <-ticker.C:
+				s.write(func(w *bytes.Buffer) { w.WriteString(":\n\n") })
+			}
+		}
+	}()
+	return s
+}
+
+// Send an event to the client.
+func (s *EventStream) Send(event Event) error {
+	buf := &bytes.Buffer{}
+	if err := s.cx.Serializers().Encode(s.contentType, buf, event.Data); err != nil {
+		return err
+	}
+	data := bytes.TrimRight(buf.Bytes(), "\n")
+	if !isTextContentType(s.contentType) {
+		data = []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+	return s.write(func(w *bytes.Buffer) {
+		if event.ID != "" {
+			fmt.Fprintf(w, "id: %s\n", stripNewlines(event.ID))
+		}
+		if event.Type != "" {
+			fmt.Fprintf(w, "event: %s\n", stripNewlines(event.Type))
+		}
+		if event.Retry > 0 {
+			fmt.Fprintf(w, "retry: %d\n", event.Retry.Milliseconds())
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			w.WriteString("data: ")
+			w.Write(bytes.TrimSuffix(line, []byte("\r")))
+			w.WriteString("\n")
+		}
+		w.WriteString("\n")
+	})
+}
+
+// End stops the stream, returning the Response for the handler to return.
+func (s *EventStream) End() *Response {
+	s.stop()
+	return ResponseFromContext(s.cx, func(http.ResponseWriter) {})
+}
+
+func (s *EventStream) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stopped = true
+	if s.heartbeat != nil {
+		close(s.heartbeat)
+		s.heartbeat = nil
+	}
+}
+
+// Write a chunk of the stream and flush it to the client.
+func (s *EventStream) write(f func(w *bytes.Buffer)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return io.ErrClosedPipe
+	}
+	if err := s.cx.Request.Context().Err(); err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	f(buf)
+	if _, err := s.cx.Response.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *EventStream) flush() {
+	if f, ok := s.cx.Response.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Stop any event stream started by the handler, so that heartbeats are not
+// written after the handler has returned.
+func (c *Context) stopStream() {
+	if c.stream != nil {
+		c.stream.stop()
+	}
+}
+
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// Content types whose encoding is text, and so can be sent as event data
+// without base64 encoding.
+func isTextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" || mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// Subscription is a Server-Sent Events subscription created by
+// Client.Subscribe.
+type Subscription struct {
+	client *Client
+	name   string
+	args   Args
+	events reflect.Value
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+	lastID string
+	retry  time.Duration
+	err    error
+}
+
+// Subscribe to the event stream of the named route, sending the decoded data
+// of each event to events, which must be a channel of the event data type,
+// eg. chan *Item. The channel is closed when the subscription ends.
+//
+// If the connection is lost, the subscription reconnects after the retry
+// delay requested by the server (3s by default), resuming from the last
+// event received via Last-Event-ID.
+func (c *Client) Subscribe(name string, args Args, events interface{}) (*Subscription, error) {
+	ch := reflect.ValueOf(events)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.SendDir == 0 {
+		return nil, fmt.Errorf("expected a channel to send events to but got %T", events)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Subscription{
+		client: c,
+		name:   name,
+		args:   args,
+		events: ch,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		retry:  3 * time.Second,
+	}
+	resp, err := s.connect(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go s.run(ctx, resp)
+	return s, nil
+}
+
+// Close the subscription.
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Done is closed when the subscription ends.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that ended the subscription, if any.
+func (s *Subscription) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// LastEventID returns the ID of the last event received.
+func (s *Subscription) LastEventID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lastID
+}
+
+func (s *Subscription) connect(ctx context.Context) (*http.Response, error) {
+	c := s.client
+	req, err := c.MakeRequest(s.name, s.args, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Del("Content-Type")
+	req.Header.Set("Accept", EventStreamContentType+", "+c.encoding+";q=0.9")
+	if id := s.LastEventID(); id != "" {
+		req.Header.Set("Last-Event-ID", id)
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &ClientError{
+			status: resp.StatusCode,
+			err:    fmt.Sprintf("HTTP error (%d): %s", resp.StatusCode, resp.Status),
+		}
+	}
+	if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct != EventStreamContentType {
+		resp.Body.Close()
+		return nil, &ClientError{
+			status: resp.StatusCode,
+			err:    fmt.Sprintf("expected %s response from %s, got %s", EventStreamContentType, req.URL, ct),
+		}
+	}
+	return resp, nil
+}
+
+func (s *Subscription) run(ctx context.Context, resp *http.Response) {
+	defer close(s.done)
+	defer s.events.Close()
+	for {
+		err := s.read(ctx, resp)
+		resp.Body.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		// The connection was lost, so reconnect after the retry delay.
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.retryDelay()):
+			}
+			resp, err = s.connect(ctx)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if clientError, ok := err.(*ClientError); ok && clientError.status < 500 {
+				s.fail(err)
+				return
+			}
+		}
+	}
+}
+
+func (s *Subscription) fail(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err
+}
+
+func (s *Subscription) retryDelay() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.retry
+}
+
+// Read events from a connected stream until the connection is lost.
+// Returns an error only if an event can not be decoded.
+func (s *Subscription) read(ctx context.Context, resp *http.Response) error {
+	contentType := resp.Header.Get(eventContentTypeHeader)
+	if contentType == "" {
+		contentType = s.client.encoding
+	}
+	reader := bufio.NewReader(resp.Body)
+	var id string
+	var data []string
+	hasID := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if hasID {
+				s.lock.Lock()
+				s.lastID = id
+				s.lock.Unlock()
+			}
+			if len(data) > 0 {
+				if err := s.dispatch(ctx, contentType, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+			data, hasID = nil, false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "id":
+			id, hasID = value, true
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				s.lock.Lock()
+				s.retry = time.Duration(ms) * time.Millisecond
+				s.lock.Unlock()
+			}
+		}
+	}
+}
+
+// Decode event data and send it to the events channel.
+func (s *Subscription) dispatch(ctx context.Context, contentType, data string) error {
+	var body io.Reader = strings.NewReader(data)
+	if !isTextContentType(contentType) {
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+	t := s.events.Type().Elem()
+	v := reflect.New(t)
+	if t.Kind() == reflect.Ptr {
+		v.Elem().Set(reflect.New(t.Elem()))
+		v = v.Elem()
+	}
+	if err := s.client.registry().Decode(contentType, body, v.Interface()); err != nil {
+		return err
+	}
+	if t.Kind() != reflect.Ptr {
+		v = v.Elem()
+	}
+	chosen, _, _ := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: s.events, Send: v},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	})
+	if chosen == 1 {
+		return ctx.Err()
+	}
+	return nil
+}
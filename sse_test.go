@@ -0,0 +1,52 @@
+package pathways
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamEventSourceAccept(t *testing.T) {
+	s := NewService("/api")
+	sendErrors := make(chan error, 1)
+	s.Path("/events").Get().APIFunction(func(cx *Context) *Response {
+		stream := cx.Stream()
+		sendErrors <- stream.Send(Event{ID: "1", Data: map[string]int{"n": 1}})
+		return stream.End()
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	for _, accept := range []string{"text/event-stream", "text/event-stream, */*", ""} {
+		req, _ := http.NewRequest("GET", server.URL+"/api/events", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err := <-sendErrors; err != nil {
+			t.Fatalf("Accept %q: send failed: %s", accept, err)
+		}
+		if ct := resp.Header.Get(eventContentTypeHeader); ct != "application/json" {
+			t.Errorf("Accept %q: expected JSON event data but got %q", accept, ct)
+		}
+		if !strings.Contains(string(body), "id: 1\ndata: {\"n\":1}\n\n") {
+			t.Errorf("Accept %q: unexpected stream %q", accept, body)
+		}
+	}
+}
+
+func TestStreamNegotiatesEventData(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/event-stream, application/x-msgpack;q=0.9")
+	cx := &Context{Request: req}
+	if ct := cx.eventContentType(); ct != "application/x-msgpack" {
+		t.Fatalf("expected msgpack but got %q", ct)
+	}
+}
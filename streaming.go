@@ -0,0 +1,386 @@
+package pathways
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Media types of streamed collections.
+const (
+	NDJSONContentType        = "application/x-ndjson"
+	MsgpackStreamContentType = "application/x-msgpack-stream"
+)
+
+// StreamFormat describes how the records of a streamed collection are
+// encoded and framed.
+type StreamFormat struct {
+	// Content type of the serializer used to encode each record.
+	ContentType string
+	// Delimited records are terminated by a newline, so the serializer must
+	// not emit newlines. Otherwise each record is prefixed with its length as
+	// a 4 byte big-endian integer.
+	Delimited bool
+}
+
+var (
+	// StreamFormats available to streamed responses, keyed by media type.
+	StreamFormats = map[string]StreamFormat{
+		NDJSONContentType:        {ContentType: "application/json", Delimited: true},
+		MsgpackStreamContentType: {ContentType: "application/x-msgpack"},
+	}
+	// ErrRecordTooLarge is returned when a length-prefixed record exceeds
+	// MaxStreamRecordSize.
+	ErrRecordTooLarge = errors.New("stream record too large")
+)
+
+// MaxStreamRecordSize is the largest length-prefixed record a client will
+// accept.
+var MaxStreamRecordSize = 16 << 20
+
+// Interval after which buffered records are flushed to the client, if the
+// items are not arriving quickly enough to fill the buffer.
+const streamFlushInterval = 100 * time.Millisecond
+
+// Trailer reporting an error that ended a streamed response.
+const streamErrorTrailer = "X-Stream-Error"
+
+// An Iterator yields the items of a streamed response. Next returns false
+// when there are no more items. Next is called from its own goroutine, which
+// may still be blocked in Next after the response has ended if the client
+// disconnects.
+type Iterator interface {
+	Next() (item interface{}, ok bool, err error)
+}
+
+// IteratorFunc adapts a function to an Iterator.
+type IteratorFunc func() (interface{}, bool, error)
+
+func (f IteratorFunc) Next() (interface{}, bool, error) {
+	return f()
+}
+
+// StreamItems responds with a collection that is encoded one record at a
+// time, as newline delimited JSON or length-prefixed msgpack depending on the
+// Accept header. items is either an Iterator or a channel, which the handler
+// should close when done.
+//
+// Records are buffered and flushed whenever no item is ready. Iterators are
+// advanced on a separate goroutine, so that records are flushed while Next
+// blocks. Items are only consumed as fast as the client reads them, and
+// streaming stops if the client disconnects. An error from an Iterator ends
+// the response, and is reported to the client in the X-Stream-Error trailer.
+func (c *Context) StreamItems(items interface{}) *Response {
+	return ResponseFromContext(c, func(w http.ResponseWriter) {
+		stop := make(chan struct{})
+		defer close(stop)
+		next, ready, err := itemSource(items, c.Request.Context().Done(), stop)
+		if err != nil {
+			c.APIError(http.StatusInternalServerError, err.Error()).Write()
+			return
+		}
+		contentType := c.streamContentType()
+		format := StreamFormats[contentType]
+		serializers := c.Serializers()
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Trailer", streamErrorTrailer)
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusOK)
+
+		out := bufio.NewWriterSize(w, 32<<10)
+		flush := func() error {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return nil
+		}
+		lastFlush := time.Now()
+		record := &bytes.Buffer{}
+		for {
+			if out.Buffered() > 0 && (!ready() || time.Since(lastFlush) >= streamFlushInterval) {
+				if flush() != nil {
+					return
+				}
+				lastFlush = time.Now()
+			}
+			item, ok, err := next()
+			if err != nil {
+				w.Header().Set(streamErrorTrailer, err.Error())
+				break
+			}
+			if !ok {
+				break
+			}
+			record.Reset()
+			if err := serializers.Encode(format.ContentType, record, item); err != nil {
+				w.Header().Set(streamErrorTrailer, err.Error())
+				break
+			}
+			if err := writeRecord(out, format, record.Bytes()); err != nil {
+				// The client has gone away.
+				return
+			}
+		}
+		flush()
+	})
+}
+
+// Negotiate the stream format from the Accept header, defaulting to NDJSON.
+func (c *Context) streamContentType() string {
+	available := make([]string, 0, len(StreamFormats))
+	for contentType := range StreamFormats {
+		available = append(available, contentType)
+	}
+	sort.Strings(available)
+	contentType := negotiateContentType(parseAccept(c.Request.Header.Get("Accept")), available, NDJSONContentType)
+	if _, ok := StreamFormats[contentType]; !ok {
+		return NDJSONContentType
+	}
+	return contentType
+}
+
+// Number of items an Iterator may be advanced ahead of the client.
+const iteratorReadAhead = 16
+
+type iteratorResult struct {
+	item interface{}
+	err  error
+}
+
+// Adapt an Iterator or channel to a function returning the next item, and a
+// function reporting whether the next item is available without blocking.
+// Iteration ends when done is closed. An Iterator is advanced on its own
+// goroutine until it is exhausted or stop is closed.
+func itemSource(items interface{}, done, stop <-chan struct{}) (func() (interface{}, bool, error), func() bool, error) {
+	if iterator, ok := items.(Iterator); ok {
+		results := make(chan iteratorResult, iteratorReadAhead)
+		go func() {
+			defer close(results)
+			for {
+				item, ok, err := iterator.Next()
+				if err == nil && !ok {
+					return
+				}
+				select {
+				case results <- iteratorResult{item, err}:
+				case <-stop:
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+		next := func() (interface{}, bool, error) {
+			select {
+			case result, ok := <-results:
+				if !ok {
+					return nil, false, nil
+				}
+				return result.item, result.err == nil, result.err
+			case <-done:
+				return nil, false, nil
+			}
+		}
+		return next, func() bool { return len(results) > 0 }, nil
+	}
+	ch := reflect.ValueOf(items)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, nil, fmt.Errorf("can't stream %T, expected an Iterator or channel", items)
+	}
+	next := func() (interface{}, bool, error) {
+		chosen, item, ok := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: ch},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		})
+		if chosen == 1 || !ok {
+			return nil, false, nil
+		}
+		return item.Interface(), true, nil
+	}
+	return next, func() bool { return ch.Len() > 0 }, nil
+}
+
+func writeRecord(w io.Writer, format StreamFormat, record []byte) error {
+	if format.Delimited {
+		record = bytes.TrimRight(record, "\n")
+		if bytes.IndexByte(record, '\n') >= 0 {
+			return fmt.Errorf("%s record contains a newline", format.ContentType)
+		}
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+		_, err := w.Write([]byte{'\n'})
+		return err
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(record)))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(record)
+	return err
+}
+
+// ItemStream incrementally decodes a streamed collection.
+type ItemStream struct {
+	client *Client
+	resp   *http.Response
+	body   io.Reader // Before decompression.
+	format StreamFormat
+	reader *bufio.Reader
+	err    error
+}
+
+// Stream calls a route that responds with StreamItems, returning a stream
+// that decodes one item at a time, eg.
+//
+//	stream, err := client.Stream("Export", pathways.Args{}, nil)
+//	defer stream.Close()
+//	item := &Item{}
+//	for stream.Next(item) {
+//		...
+//	}
+//	if err := stream.Err(); err != nil {
+//		...
+//	}
+//
+// Length-prefixed msgpack is requested if the client encoding is
+// msgpack, otherwise newline delimited JSON.
+func (c *Client) Stream(name string, args Args, request interface{}) (*ItemStream, error) {
+	var body []byte
+	if request != nil {
+		bodyw := &bytes.Buffer{}
+		if err := c.registry().Encode(c.encoding, bodyw, request); err != nil {
+			return nil, err
+		}
+		body = bodyw.Bytes()
+	}
+	req, err := c.MakeRequest(name, args, body)
+	if err != nil {
+		return nil, err
+	}
+	accept := NDJSONContentType
+	for contentType, format := range StreamFormats {
+		if format.ContentType == c.encoding {
+			accept = contentType
+		}
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Accept-Encoding", strings.Join(Compressors.Codings(), ", "))
+
+	span := c.startSpan(name, req)
+	resp, err := c.Client.Do(req)
+	c.finishSpan(span, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	raw := resp.Body
+	if err := decompressResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &ClientError{
+			status: resp.StatusCode,
+			err:    fmt.Sprintf("HTTP error (%d): %s", resp.StatusCode, resp.Status),
+		}
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	format, ok := StreamFormats[ct]
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("expected a streamed response from %s, got %s", req.URL, ct)
+	}
+	return &ItemStream{
+		client: c,
+		resp:   resp,
+		body:   raw,
+		format: format,
+		reader: bufio.NewReader(resp.Body),
+	}, nil
+}
+
+// Next decodes the next item into v. Returns false at the end of the stream
+// or if an error occurs.
+func (s *ItemStream) Next(v interface{}) bool {
+	if s.err != nil {
+		return false
+	}
+	record, err := s.readRecord()
+	if err == io.EOF {
+		// Trailers are only available once the body has been read in full.
+		io.Copy(io.Discard, s.body)
+		if trailer := s.resp.Trailer.Get(streamErrorTrailer); trailer != "" {
+			s.err = errors.New(trailer)
+		}
+		s.Close()
+		return false
+	} else if err != nil {
+		s.err = err
+		s.Close()
+		return false
+	}
+	if err := s.client.registry().Decode(s.format.ContentType, bytes.NewReader(record), v); err != nil {
+		s.err = err
+		s.Close()
+		return false
+	}
+	return true
+}
+
+func (s *ItemStream) readRecord() ([]byte, error) {
+	if s.format.Delimited {
+		for {
+			line, err := s.reader.ReadBytes('\n')
+			if err == io.EOF && len(bytes.TrimSpace(line)) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return nil, err
+			}
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				return line, nil
+			}
+		}
+	}
+	var length [4]byte
+	if _, err := io.ReadFull(s.reader, length[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if int64(size) > int64(MaxStreamRecordSize) {
+		return nil, ErrRecordTooLarge
+	}
+	record := make([]byte, size)
+	if _, err := io.ReadFull(s.reader, record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// Err returns the error, if any, that ended the stream.
+func (s *ItemStream) Err() error {
+	return s.err
+}
+
+// Close the stream, discarding any remaining items.
+func (s *ItemStream) Close() error {
+	return s.resp.Body.Close()
+}
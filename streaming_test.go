@@ -0,0 +1,220 @@
+package pathways
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type record struct {
+	N    int    `json:"n" msgpack:"n"`
+	Name string `json:"name" msgpack:"name"`
+}
+
+// Iterator over n records, failing with err after them if it is not nil.
+type recordIterator struct {
+	n, i int
+	err  error
+}
+
+func (r *recordIterator) Next() (interface{}, bool, error) {
+	if r.i >= r.n {
+		return nil, false, r.err
+	}
+	r.i++
+	return &record{N: r.i, Name: "record"}, true, nil
+}
+
+func recordService(root string) *Service {
+	s := NewService(root)
+	s.Path("/records").Name("Records").Get()
+	s.Path("/failing").Name("Failing").Get()
+	s.Path("/channel").Name("Channel").Get()
+	return s
+}
+
+func recordServer() (*httptest.Server, *Service) {
+	s := recordService("/api")
+	s.Find("Records").APIFunction(func(cx *Context) *Response {
+		return cx.StreamItems(&recordIterator{n: 3})
+	})
+	s.Find("Failing").APIFunction(func(cx *Context) *Response {
+		return cx.StreamItems(&recordIterator{n: 2, err: errors.New("cursor failed")})
+	})
+	s.Find("Channel").APIFunction(func(cx *Context) *Response {
+		ch := make(chan *record)
+		go func() {
+			defer close(ch)
+			for i := 1; i <= 3; i++ {
+				ch <- &record{N: i, Name: "record"}
+			}
+		}()
+		return cx.StreamItems(ch)
+	})
+	server := httptest.NewServer(s)
+	return server, recordService(server.URL + "/api")
+}
+
+func readRecords(t *testing.T, client *Client, name string) ([]record, error) {
+	t.Helper()
+	stream, err := client.Stream(name, Args{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	records := []record{}
+	item := &record{}
+	for stream.Next(item) {
+		records = append(records, *item)
+	}
+	return records, stream.Err()
+}
+
+func TestStreamItemsRoundTrip(t *testing.T) {
+	server, service := recordServer()
+	defer server.Close()
+	expected := []record{{1, "record"}, {2, "record"}, {3, "record"}}
+	for _, encoding := range []string{"application/json", "application/x-msgpack"} {
+		for _, name := range []string{"Records", "Channel"} {
+			records, err := readRecords(t, NewClient(service, encoding), name)
+			if err != nil {
+				t.Errorf("%s %s: %s", encoding, name, err)
+			}
+			if !reflect.DeepEqual(records, expected) {
+				t.Errorf("%s %s: expected %v but got %v", encoding, name, expected, records)
+			}
+		}
+	}
+}
+
+func TestStreamItemsFormat(t *testing.T) {
+	server, _ := recordServer()
+	defer server.Close()
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", NDJSONContentType, "{\"n\":1,\"name\":\"record\"}\n{\"n\":2,\"name\":\"record\"}\n{\"n\":3,\"name\":\"record\"}\n"},
+		{"application/json", NDJSONContentType, "{\"n\":1,\"name\":\"record\"}\n{\"n\":2,\"name\":\"record\"}\n{\"n\":3,\"name\":\"record\"}\n"},
+		{MsgpackStreamContentType, MsgpackStreamContentType, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", server.URL+"/api/records", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != test.contentType {
+			t.Errorf("Accept %q: expected %s but got %s", test.accept, test.contentType, ct)
+		}
+		if test.body != "" && string(body) != test.body {
+			t.Errorf("Accept %q: unexpected body %q", test.accept, body)
+		}
+		if test.contentType == MsgpackStreamContentType {
+			// Three length-prefixed records.
+			for i := 0; i < 3; i++ {
+				if len(body) < 4 {
+					t.Fatalf("truncated msgpack stream %x", body)
+				}
+				size := int(body[0])<<24 | int(body[1])<<16 | int(body[2])<<8 | int(body[3])
+				body = body[4+size:]
+			}
+			if len(body) != 0 {
+				t.Errorf("unexpected trailing data %x", body)
+			}
+		}
+	}
+}
+
+func TestStreamItemsErrorTrailer(t *testing.T) {
+	server, service := recordServer()
+	defer server.Close()
+	for _, encoding := range []string{"application/json", "application/x-msgpack"} {
+		records, err := readRecords(t, NewClient(service, encoding), "Failing")
+		if err == nil || err.Error() != "cursor failed" {
+			t.Errorf("%s: expected the trailer error but got %v", encoding, err)
+		}
+		if len(records) != 2 {
+			t.Errorf("%s: expected the records before the error but got %v", encoding, records)
+		}
+	}
+}
+
+// An iterator that blocks after its first record until released.
+type blockingIterator struct {
+	sent    bool
+	release chan struct{}
+}
+
+func (b *blockingIterator) Next() (interface{}, bool, error) {
+	if !b.sent {
+		b.sent = true
+		return &record{N: 1}, true, nil
+	}
+	<-b.release
+	return nil, false, nil
+}
+
+func TestStreamItemsFlushesWhileIteratorBlocks(t *testing.T) {
+	iterator := &blockingIterator{release: make(chan struct{})}
+	s := NewService("/api")
+	s.Path("/slow").Get().APIFunction(func(cx *Context) *Response {
+		return cx.StreamItems(iterator)
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+	defer close(iterator.release)
+
+	resp, err := http.Get(server.URL + "/api/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if line != "{\"n\":1,\"name\":\"\"}\n" {
+			t.Errorf("unexpected record %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the first record was not flushed while the iterator was blocked")
+	}
+}
+
+func TestItemStreamRecordTooLarge(t *testing.T) {
+	server, service := recordServer()
+	defer server.Close()
+	defer func(size int) { MaxStreamRecordSize = size }(MaxStreamRecordSize)
+	MaxStreamRecordSize = 4
+	_, err := readRecords(t, NewClient(service, "application/x-msgpack"), "Records")
+	if err != ErrRecordTooLarge {
+		t.Errorf("expected ErrRecordTooLarge but got %v", err)
+	}
+}
+
+func TestStreamItemsRejectsOtherValues(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/bad").Get().APIFunction(func(cx *Context) *Response {
+		return cx.StreamItems([]int{1, 2})
+	})
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/api/bad", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 but got %d: %s", w.Code, w.Body.String())
+	}
+}
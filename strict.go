@@ -0,0 +1,203 @@
+package pathways
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/vmihailenco/msgpack"
+	"github.com/youtube/vitess/go/bson"
+)
+
+var ErrTrailingData = errors.New("unexpected data after value")
+
+// A StrictSerializer can create decoders that reject unknown fields and
+// trailing data, rather than silently ignoring them.
+type StrictSerializer interface {
+	Serializer
+	NewStrictDecoder(r io.Reader) ContentTypeDecoder
+}
+
+// DecodeRequestStrict decodes the request body with the strict decoder for
+// contentType, if the serializer supports it.
+func (s SerializerMap) DecodeRequestStrict(req *http.Request, contentType string, v interface{}) error {
+	return s.decodeRequest(req, contentType, v, true)
+}
+
+// DecodeStrict decodes with the strict decoder for ct, if the serializer
+// supports it.
+func (s SerializerMap) DecodeStrict(ct string, r io.Reader, v interface{}) error {
+	return s.decode(ct, r, v, true)
+}
+
+// Strict decoding into APIRequestType values for all routes in this service.
+// See Route.Strict.
+func (s *Service) Strict(strict bool) *Service {
+	s.strict = strict
+	return s
+}
+
+// Strict decoding of the request body into the APIRequestType value. Unknown
+// fields and trailing data are rejected with a 400, and JSON numbers decoded
+// into interface{} values are preserved as json.Number. Serializers that do
+// not implement StrictSerializer decode as usual.
+func (r *Route) Strict() *Route {
+	r.strict = true
+	return r
+}
+
+func (r *Route) isStrict() bool {
+	return r.strict || (r.service != nil && r.service.strict)
+}
+
+// NewStrictDecoder returns a JSON decoder that disallows unknown fields and
+// trailing data, and decodes numbers as json.Number.
+func (j *JsonSerializer) NewStrictDecoder(r io.Reader) ContentTypeDecoder {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	return &jsonDecoder{decoder: decoder, strict: true}
+}
+
+// NewStrictDecoder returns a msgpack decoder that rejects fields not present
+// in the target struct, and trailing data.
+func (j *MsgpackSerializer) NewStrictDecoder(r io.Reader) ContentTypeDecoder {
+	return &strictMsgpackDecoder{r}
+}
+
+type strictMsgpackDecoder struct {
+	r io.Reader
+}
+
+func (s *strictMsgpackDecoder) Decode(v interface{}) error {
+	data, err := ioutil.ReadAll(s.r)
+	if err != nil {
+		return err
+	}
+	reader := bytes.NewReader(data)
+	var generic interface{}
+	if err := msgpack.NewDecoder(reader).Decode(&generic); err != nil {
+		return err
+	}
+	if reader.Len() > 0 {
+		return ErrTrailingData
+	}
+	if err := checkUnknownFields(generic, reflect.TypeOf(v), "msgpack", ""); err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(data, v)
+}
+
+// NewStrictDecoder returns a BSON decoder that rejects fields not present in
+// the target struct, and data following the document.
+func (j *BsonSerializer) NewStrictDecoder(r io.Reader) ContentTypeDecoder {
+	return &strictBsonDecoder{r}
+}
+
+type strictBsonDecoder struct {
+	r io.Reader
+}
+
+func (s *strictBsonDecoder) Decode(v interface{}) error {
+	data, err := ioutil.ReadAll(s.r)
+	if err != nil {
+		return err
+	}
+	// A BSON document is prefixed with its total length.
+	if len(data) < 4 {
+		return io.ErrUnexpectedEOF
+	}
+	if int(binary.LittleEndian.Uint32(data)) != len(data) {
+		return ErrTrailingData
+	}
+	generic := map[string]interface{}{}
+	if err := bson.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	if err := checkUnknownFields(generic, reflect.TypeOf(v), "bson", ""); err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, v)
+}
+
+// Check that every key in the generically decoded value corresponds to a
+// field in t, recursing into nested structs, slices and maps.
+func checkUnknownFields(value interface{}, t reflect.Type, tag string, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	rv := reflect.ValueOf(value)
+	switch t.Kind() {
+	case reflect.Struct:
+		if rv.Kind() != reflect.Map {
+			return nil
+		}
+		fields := structFields(t, tag)
+		for _, key := range sortedMapKeys(rv) {
+			name := fmt.Sprint(key.Interface())
+			field, ok := fields[name]
+			if !ok {
+				return fmt.Errorf("unknown field %q", joinFieldPath(path, name))
+			}
+			if err := checkUnknownFields(rv.MapIndex(key).Interface(), field.Type, tag, joinFieldPath(path, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() != reflect.Slice {
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := checkUnknownFields(rv.Index(i).Interface(), t.Elem(), tag, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if rv.Kind() != reflect.Map {
+			return nil
+		}
+		for _, key := range rv.MapKeys() {
+			if err := checkUnknownFields(rv.MapIndex(key).Interface(), t.Elem(), tag, fmt.Sprintf("%s[%v]", path, key.Interface())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Map of serialized field names to struct fields, using the given tag for
+// names and flattening embedded structs.
+func structFields(t reflect.Type, tag string) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for n, f := range structFields(embedded, tag) {
+					fields[n] = f
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
@@ -0,0 +1,104 @@
+package pathways
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack"
+)
+
+type strictAddress struct {
+	City string `json:"city" msgpack:"city" cbor:"city"`
+}
+
+type strictRequest struct {
+	Name      string          `json:"name" msgpack:"name" cbor:"name"`
+	Addresses []strictAddress `json:"addresses" msgpack:"addresses" cbor:"addresses"`
+	Extra     interface{}     `json:"extra" msgpack:"extra" cbor:"extra"`
+}
+
+func strictService(strict bool) *Service {
+	s := NewService("/api").Strict(strict)
+	s.Path("/strict").Post().APIRequestType(&strictRequest{}).APIFunction(func(cx *Context, req *strictRequest) *Response {
+		return cx.APIResponse(http.StatusOK, req)
+	})
+	return s
+}
+
+func postStrict(s *Service, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/strict", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestStrictDecoding(t *testing.T) {
+	encoders := map[string]func(v interface{}) ([]byte, error){
+		"application/json":      json.Marshal,
+		"application/x-msgpack": msgpack.Marshal,
+		"application/cbor":      cbor.Marshal,
+	}
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		err  string
+	}{
+		{"Valid", map[string]interface{}{"name": "a", "addresses": []interface{}{map[string]interface{}{"city": "x"}}}, ""},
+		{"UnknownField", map[string]interface{}{"name": "a", "nickname": "b"}, "unknown field"},
+		{"UnknownNestedField", map[string]interface{}{"addresses": []interface{}{map[string]interface{}{"city": "x", "zip": "1"}}}, "unknown field"},
+	}
+	for contentType, encode := range encoders {
+		for _, test := range tests {
+			body, err := encode(test.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := postStrict(strictService(true), contentType, body)
+			if test.err == "" && w.Code != http.StatusOK {
+				t.Errorf("%s %s: expected 200 but got %d: %s", contentType, test.name, w.Code, w.Body.String())
+			} else if test.err != "" && (w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), test.err)) {
+				t.Errorf("%s %s: expected 400 %q but got %d: %s", contentType, test.name, test.err, w.Code, w.Body.String())
+			}
+			// Without strict mode unknown fields are ignored.
+			if w := postStrict(strictService(false), contentType, body); w.Code != http.StatusOK {
+				t.Errorf("%s %s: expected 200 without strict mode but got %d: %s", contentType, test.name, w.Code, w.Body.String())
+			}
+		}
+
+		body, _ := encode(map[string]interface{}{"name": "a"})
+		w := postStrict(strictService(true), contentType, append(body, body...))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrTrailingData.Error()) {
+			t.Errorf("%s: expected trailing data to be rejected but got %d: %s", contentType, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestStrictRoute(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/strict").Post().Strict().APIRequestType(&strictRequest{}).APIFunction(func(cx *Context, req *strictRequest) *Response {
+		return cx.APIResponse(http.StatusOK, req)
+	})
+	w := postStrict(s, "application/json", []byte(`{"name":"a","nickname":"b"}`))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `unknown field \"nickname\"`) {
+		t.Errorf("expected 400 but got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStrictJSONNumbers(t *testing.T) {
+	req := &strictRequest{}
+	err := Serializers.DecodeStrict("application/json", strings.NewReader(`{"extra":12345678901234567890}`), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := json.Number("12345678901234567890"); !reflect.DeepEqual(req.Extra, expected) {
+		t.Errorf("expected %#v but got %#v", expected, req.Extra)
+	}
+}
@@ -0,0 +1,239 @@
+package pathways
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	traceParentHeader = "traceparent"
+	traceStateHeader  = "tracestate"
+
+	// Trace flag indicating that the caller may have recorded the trace.
+	TraceFlagSampled = 0x01
+)
+
+var ErrInvalidTraceParent = errors.New("invalid traceparent header")
+
+// SpanContext identifies a span within a trace, as propagated by the W3C
+// Trace Context traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	// Opaque vendor-specific trace state.
+	State string
+}
+
+// ParseTraceParent parses a W3C traceparent header of the form
+// "00-<trace-id>-<span-id>-<flags>".
+func ParseTraceParent(header string) (SpanContext, error) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, ErrInvalidTraceParent
+	}
+	// Version 00 has exactly four fields, later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, ErrInvalidTraceParent
+	}
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return sc, ErrInvalidTraceParent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceParent
+	}
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// IsValid returns true if both the trace and span IDs are non-zero.
+func (s SpanContext) IsValid() bool {
+	return s.TraceID != [16]byte{} && s.SpanID != [8]byte{}
+}
+
+func (s SpanContext) Sampled() bool {
+	return s.Flags&TraceFlagSampled != 0
+}
+
+// TraceParent formats the span context as a traceparent header value.
+func (s SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", s.TraceID, s.SpanID, s.Flags)
+}
+
+// Child returns a new span context in the same trace as s. If s is not valid
+// a new sampled trace is started.
+func (s SpanContext) Child() SpanContext {
+	child := SpanContext{TraceID: s.TraceID, Flags: s.Flags, State: s.State}
+	if !s.IsValid() {
+		rand.Read(child.TraceID[:])
+		child.Flags = TraceFlagSampled
+		child.State = ""
+	}
+	rand.Read(child.SpanID[:])
+	return child
+}
+
+// Inject the span context into outgoing request headers.
+func (s SpanContext) Inject(header http.Header) {
+	header.Set(traceParentHeader, s.TraceParent())
+	if s.State != "" {
+		header.Set(traceStateHeader, s.State)
+	} else {
+		header.Del(traceStateHeader)
+	}
+}
+
+// Extract a span context from incoming request headers.
+func ExtractSpanContext(header http.Header) (SpanContext, error) {
+	sc, err := ParseTraceParent(header.Get(traceParentHeader))
+	if err != nil {
+		return sc, err
+	}
+	sc.State = strings.Join(header.Values(traceStateHeader), ",")
+	return sc, nil
+}
+
+// Kinds of Span.
+const (
+	SpanKindServer = "server"
+	SpanKindClient = "client"
+)
+
+// A Span records the timing and outcome of a single request.
+type Span struct {
+	Name    string
+	Kind    string
+	Context SpanContext
+	// Parent span, if any. Will not be valid for root spans.
+	Parent SpanContext
+	Start  time.Time
+	End    time.Time
+	// HTTP status code of the response, or 0 if no response was received.
+	Status int
+	Error  string
+}
+
+func (s *Span) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{
+		"name":     s.Name,
+		"kind":     s.Kind,
+		"trace_id": hex.EncodeToString(s.Context.TraceID[:]),
+		"span_id":  hex.EncodeToString(s.Context.SpanID[:]),
+		"start":    s.Start,
+		"end":      s.End,
+		"status":   s.Status,
+	}
+	if s.Parent.IsValid() {
+		out["parent_id"] = hex.EncodeToString(s.Parent.SpanID[:])
+	}
+	if s.Error != "" {
+		out["error"] = s.Error
+	}
+	return json.Marshal(out)
+}
+
+// A SpanExporter receives completed, sampled spans.
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// InMemoryExporter retains all exported spans. Useful for tests.
+type InMemoryExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (m *InMemoryExporter) ExportSpan(span *Span) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.spans = append(m.spans, span)
+}
+
+// Spans returns a copy of the spans exported so far.
+func (m *InMemoryExporter) Spans() []*Span {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]*Span{}, m.spans...)
+}
+
+func (m *InMemoryExporter) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.spans = nil
+}
+
+// WriterExporter writes each span to an io.Writer as a line of JSON.
+type WriterExporter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewStdoutExporter writes spans to stdout as JSON lines.
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+func (w *WriterExporter) ExportSpan(span *Span) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	json.NewEncoder(w.w).Encode(span)
+}
+
+// SpanExporter to send server spans to.
+func (s *Service) SpanExporter(exporter SpanExporter) *Service {
+	s.exporter = exporter
+	return s
+}
+
+// Start a server span for the request, as a child of any incoming trace
+// context.
+func (r *Route) startSpan(cx *Context) *Span {
+	parent, _ := ExtractSpanContext(cx.Request.Header)
+	span := &Span{
+		Name:    r.name,
+		Kind:    SpanKindServer,
+		Context: parent.Child(),
+		Parent:  parent,
+		Start:   time.Now(),
+	}
+	cx.Trace = span.Context
+	return span
+}
+
+func (r *Route) finishSpan(cx *Context, span *Span) {
+	if r.service == nil || r.service.exporter == nil || !span.Context.Sampled() {
+		return
+	}
+	span.End = time.Now()
+	if cx.status != nil {
+		span.Status = cx.status.Status()
+	}
+	r.service.exporter.ExportSpan(span)
+}
@@ -0,0 +1,30 @@
+package pathways
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerSpanStatusWithCompression(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	s := NewService("/api").SpanExporter(exporter).Compression(CompressionOptions{MinSize: 1})
+	s.Path("/missing").Get().Name("Missing").APIFunction(func(cx *Context) *Response {
+		return cx.APIError(http.StatusNotFound, "not found")
+	})
+	req := httptest.NewRequest("GET", "/api/missing", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected a compressed response")
+	}
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span but got %d", len(spans))
+	}
+	if spans[0].Status != http.StatusNotFound {
+		t.Fatalf("expected span status 404 but got %d", spans[0].Status)
+	}
+}
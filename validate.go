@@ -0,0 +1,357 @@
+package pathways
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// A FieldError describes a single field that failed validation.
+type FieldError struct {
+	// Path to the field, eg. "items[2].name". Empty for errors returned by a
+	// Validate() method on the top-level value.
+	Field string
+	Error string
+}
+
+// ValidationErrors is returned by Validate and lists every failing field.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	errors := []string{}
+	for _, err := range v {
+		if err.Field == "" {
+			errors = append(errors, err.Error)
+		} else {
+			errors = append(errors, err.Field+": "+err.Error)
+		}
+	}
+	return "validation failed: " + strings.Join(errors, "; ")
+}
+
+// A Validator can validate itself. Validate() is called after any tag based
+// rules have passed.
+type Validator interface {
+	Validate() error
+}
+
+// A Rule is a single validation rule from a `validate` struct tag, eg.
+// "min=1" is Rule{Name: "min", Arg: "1"}.
+type Rule struct {
+	Name string
+	Arg  string
+}
+
+var (
+	validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+	regexCache    sync.Map // map[string]*regexp.Regexp
+	rulesCache    sync.Map // map[reflect.Type][]fieldRules
+)
+
+// The validation rules of an exported struct field.
+type fieldRules struct {
+	index int
+	// Name of the field in error paths, or empty for embedded structs.
+	name  string
+	rules []Rule
+}
+
+// ParseRules parses a `validate` struct tag. Rules are comma separated, with
+// the exception of "regex", which must be last and extends to the end of the
+// tag.
+//
+// Supported rules are: required, min=n, max=n, len=n, regex=re,
+// oneof=a b c, and email. min and max compare the value of numbers, and the
+// length of strings, slices and maps.
+func ParseRules(tag string) ([]Rule, error) {
+	rules := []Rule{}
+	for tag != "" {
+		part := tag
+		if strings.HasPrefix(tag, "regex=") {
+			tag = ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+		rule := Rule{Name: part}
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			rule = Rule{Name: part[:i], Arg: part[i+1:]}
+		}
+		switch rule.Name {
+		case "required", "email":
+		case "min", "max", "len":
+			if _, err := strconv.ParseFloat(rule.Arg, 64); err != nil {
+				return nil, fmt.Errorf("invalid %s rule %q", rule.Name, rule.Arg)
+			}
+		case "regex":
+			if _, err := compileRegex(rule.Arg); err != nil {
+				return nil, err
+			}
+		case "oneof":
+			if rule.Arg == "" {
+				return nil, fmt.Errorf("oneof rule requires values")
+			}
+		default:
+			return nil, fmt.Errorf("unknown validation rule %q", rule.Name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// Validate v against the rules in its `validate` struct tags, recursing into
+// nested structs, slices and maps, and calling Validate() on any value that
+// implements Validator. Returns ValidationErrors if any field fails.
+func Validate(v interface{}) error {
+	errors := ValidationErrors{}
+	validateValue(reflect.ValueOf(v), "", &errors)
+	if len(errors) > 0 {
+		return errors
+	}
+	return nil
+}
+
+// Compile and cache the rules of t and any struct types it contains,
+// panicking if any `validate` tag is invalid.
+func mustCompileRules(t reflect.Type) {
+	checkRules(t, map[reflect.Type]bool{})
+}
+
+func checkRules(t reflect.Type, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+	structRules(t)
+	for i := 0; i < t.NumField(); i++ {
+		checkRules(t.Field(i).Type, seen)
+	}
+}
+
+// Returns the compiled rules for the fields of struct type t, parsing its
+// tags on first use. Panics if a tag is invalid.
+func structRules(t reflect.Type) []fieldRules {
+	if cached, ok := rulesCache.Load(t); ok {
+		return cached.([]fieldRules)
+	}
+	fields := []fieldRules{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		rules, err := ParseRules(field.Tag.Get("validate"))
+		if err != nil {
+			panic(fmt.Sprintf("%s.%s: %s", t, field.Name, err))
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := ""
+		if !field.Anonymous {
+			name = wireFieldName(field)
+		}
+		fields = append(fields, fieldRules{index: i, name: name, rules: rules})
+	}
+	rulesCache.Store(t, fields)
+	return fields
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Name of a field as it appears on the wire.
+func wireFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func validateValue(v reflect.Value, path string, errors *ValidationErrors) {
+	if !v.IsValid() {
+		return
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	failed := len(*errors)
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, field := range structRules(v.Type()) {
+			fieldPath := path
+			if field.name != "" {
+				fieldPath = joinFieldPath(path, field.name)
+			}
+			if validateRules(v.Field(field.index), field.rules, fieldPath, errors) {
+				validateValue(v.Field(field.index), fieldPath, errors)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errors)
+		}
+	case reflect.Map:
+		for _, key := range sortedMapKeys(v) {
+			validateValue(v.MapIndex(key), fmt.Sprintf("%s[%v]", path, key.Interface()), errors)
+		}
+	}
+	// Only call Validate() once the value itself is otherwise valid.
+	if len(*errors) == failed {
+		validateMethod(v, path, errors)
+	}
+}
+
+func validateMethod(v reflect.Value, path string, errors *ValidationErrors) {
+	var validator Validator
+	if v.Type().Implements(validatorType) {
+		validator = v.Interface().(Validator)
+	} else if v.CanAddr() && v.Addr().Type().Implements(validatorType) {
+		validator = v.Addr().Interface().(Validator)
+	} else if reflect.PtrTo(v.Type()).Implements(validatorType) {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		validator = p.Interface().(Validator)
+	}
+	if validator == nil {
+		return
+	}
+	if err := validator.Validate(); err != nil {
+		if nested, ok := err.(ValidationErrors); ok {
+			for _, fe := range nested {
+				*errors = append(*errors, FieldError{joinFieldPath(path, fe.Field), fe.Error})
+			}
+			return
+		}
+		*errors = append(*errors, FieldError{path, err.Error()})
+	}
+}
+
+// Apply rules to v, returning false if any fail.
+func validateRules(v reflect.Value, rules []Rule, path string, errors *ValidationErrors) bool {
+	ok := true
+	for _, rule := range rules {
+		if msg := applyRule(v, rule); msg != "" {
+			*errors = append(*errors, FieldError{path, msg})
+			ok = false
+			// Other rules are meaningless for a missing value.
+			if rule.Name == "required" {
+				break
+			}
+		}
+	}
+	return ok
+}
+
+// Apply a rule to a value, returning a description of the failure, if any.
+func applyRule(v reflect.Value, rule Rule) string {
+	if rule.Name == "required" {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		// Optional values are only validated when present.
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch rule.Name {
+	case "min", "max", "len":
+		limit, _ := strconv.ParseFloat(rule.Arg, 64)
+		size, isLength, ok := measure(v)
+		if !ok {
+			return fmt.Sprintf("%s rule can not be applied to %s", rule.Name, v.Type())
+		}
+		what := "be"
+		if isLength {
+			what = "have length"
+		}
+		switch {
+		case rule.Name == "min" && size < limit:
+			return fmt.Sprintf("must %s at least %s", what, rule.Arg)
+		case rule.Name == "max" && size > limit:
+			return fmt.Sprintf("must %s at most %s", what, rule.Arg)
+		case rule.Name == "len" && size != limit:
+			return fmt.Sprintf("must have length %s", rule.Arg)
+		}
+
+	case "regex":
+		re, _ := compileRegex(rule.Arg)
+		if v.Kind() != reflect.String {
+			return fmt.Sprintf("regex rule can not be applied to %s", v.Type())
+		}
+		if !re.MatchString(v.String()) {
+			return fmt.Sprintf("must match %s", rule.Arg)
+		}
+
+	case "oneof":
+		value := fmt.Sprint(v.Interface())
+		options := strings.Fields(rule.Arg)
+		for _, option := range options {
+			if option == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(options, ", "))
+
+	case "email":
+		if v.Kind() != reflect.String {
+			return fmt.Sprintf("email rule can not be applied to %s", v.Type())
+		}
+		if v.Len() == 0 {
+			return ""
+		}
+		addr, err := mail.ParseAddress(v.String())
+		if err != nil || addr.Address != v.String() {
+			return "must be a valid email address"
+		}
+	}
+	return ""
+}
+
+// Measure the size of a value for min/max/len rules: the numeric value of
+// numbers, or the length of strings and collections.
+func measure(v reflect.Value) (size float64, isLength bool, ok bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	}
+	return 0, false, false
+}
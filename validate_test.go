@@ -0,0 +1,66 @@
+package pathways
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateInvalidValues(t *testing.T) {
+	var nilItem *resourceItem
+	for _, v := range []interface{}{nil, nilItem, []interface{}{nil}, map[string]interface{}{"a": nil}} {
+		if err := Validate(v); err != nil {
+			t.Errorf("Validate(%#v) = %s", v, err)
+		}
+	}
+}
+
+type badRuleItem struct {
+	Name string `validate:"max=many"`
+}
+
+type badRuleRequest struct {
+	Items []badRuleItem
+}
+
+func TestInvalidRulesFailAtRegistration(t *testing.T) {
+	defer func() {
+		err := recover()
+		if msg, ok := err.(string); !ok || !strings.Contains(msg, `badRuleItem.Name: invalid max rule "many"`) {
+			t.Errorf("expected registration to panic but got %v", err)
+		}
+	}()
+	s := NewService("/api")
+	s.Path("/bad").Post().APIRequestType(&badRuleRequest{}).APIFunction(func(cx *Context, req *badRuleRequest) *Response {
+		return nil
+	})
+}
+
+type cachedRuleItem struct {
+	Name string `json:"name" validate:"required,max=3"`
+}
+
+type cachedRuleRequest struct {
+	Items []cachedRuleItem `json:"items" validate:"min=1"`
+}
+
+func TestRulesAreCompiledOnce(t *testing.T) {
+	s := NewService("/api")
+	s.Path("/cached").Post().APIRequestType(&cachedRuleRequest{}).APIFunction(func(cx *Context, req *cachedRuleRequest) *Response {
+		return cx.APIResponse(http.StatusOK, req)
+	})
+	for _, v := range []interface{}{cachedRuleRequest{}, cachedRuleItem{}} {
+		if _, ok := rulesCache.Load(reflect.TypeOf(v)); !ok {
+			t.Errorf("rules for %T were not compiled at registration", v)
+		}
+	}
+	req := httptest.NewRequest("POST", "/api/cached", strings.NewReader(`{"items":[{"name":"long"},{}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "items[0].name") || !strings.Contains(w.Body.String(), "items[1].name") {
+		t.Errorf("expected both items to fail validation but got %d: %s", w.Code, w.Body.String())
+	}
+}
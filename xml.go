@@ -0,0 +1,191 @@
+package pathways
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// XMLSerializer encodes and decodes values with encoding/xml.
+//
+// encoding/xml can not represent maps or top-level slices, so these are
+// wrapped in an envelope element. Maps are encoded as a sequence of entry
+// elements with a "key" attribute, eg.
+//
+//	<map><entry key="foo">bar</entry></map>
+//
+// and slices as a sequence of entry elements.
+type XMLSerializer struct {
+	// Name of the element wrapping maps and slices. Defaults to "map" for maps
+	// and "list" for slices.
+	Envelope string
+	// Name of the element for each map or slice entry. Defaults to "entry".
+	Entry string
+}
+
+func (x *XMLSerializer) NewEncoder(w io.Writer) ContentTypeEncoder {
+	return &xmlEncoder{x, xml.NewEncoder(w)}
+}
+
+func (x *XMLSerializer) NewDecoder(r io.Reader) ContentTypeDecoder {
+	return &xmlDecoder{x, xml.NewDecoder(r)}
+}
+
+func (x *XMLSerializer) envelope(kind reflect.Kind) string {
+	if x.Envelope != "" {
+		return x.Envelope
+	}
+	if kind == reflect.Map {
+		return "map"
+	}
+	return "list"
+}
+
+func (x *XMLSerializer) entry() string {
+	if x.Entry != "" {
+		return x.Entry
+	}
+	return "entry"
+}
+
+type xmlEncoder struct {
+	serializer *XMLSerializer
+	encoder    *xml.Encoder
+}
+
+func (x *xmlEncoder) Encode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		if rv.Kind() != reflect.Map && rv.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as character data.
+			break
+		}
+		if err := x.encodeCollection(rv); err != nil {
+			return err
+		}
+		return x.encoder.Flush()
+	}
+	return x.encoder.Encode(v)
+}
+
+func (x *xmlEncoder) encodeCollection(rv reflect.Value) error {
+	start := xml.StartElement{Name: xml.Name{Local: x.serializer.envelope(rv.Kind())}}
+	if err := x.encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	entry := xml.StartElement{Name: xml.Name{Local: x.serializer.entry()}}
+	if rv.Kind() == reflect.Map {
+		for _, key := range sortedMapKeys(rv) {
+			e := entry
+			e.Attr = []xml.Attr{{Name: xml.Name{Local: "key"}, Value: fmt.Sprint(key.Interface())}}
+			if err := x.encoder.EncodeElement(rv.MapIndex(key).Interface(), e); err != nil {
+				return err
+			}
+		}
+	} else {
+		for i := 0; i < rv.Len(); i++ {
+			if err := x.encoder.EncodeElement(rv.Index(i).Interface(), entry); err != nil {
+				return err
+			}
+		}
+	}
+	return x.encoder.EncodeToken(start.End())
+}
+
+func sortedMapKeys(rv reflect.Value) []reflect.Value {
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+type xmlDecoder struct {
+	serializer *XMLSerializer
+	decoder    *xml.Decoder
+}
+
+func (x *xmlDecoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("xml: can not decode into non-pointer %T", v)
+	}
+	target := rv.Elem()
+	for target.Kind() == reflect.Ptr {
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+	switch target.Kind() {
+	case reflect.Map:
+		if target.IsNil() {
+			target.Set(reflect.MakeMap(target.Type()))
+		}
+		return x.decodeCollection(target)
+	case reflect.Slice:
+		if target.Type().Elem().Kind() != reflect.Uint8 {
+			return x.decodeCollection(target)
+		}
+	}
+	return x.decoder.Decode(v)
+}
+
+// Decode the entries of an envelope element into a map or slice.
+func (x *xmlDecoder) decodeCollection(target reflect.Value) error {
+	if _, err := x.nextStart(); err != nil {
+		return err
+	}
+	elemType := target.Type().Elem()
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			elem := reflect.New(elemType)
+			if err := x.decoder.DecodeElement(elem.Interface(), &t); err != nil {
+				return err
+			}
+			if target.Kind() == reflect.Slice {
+				target.Set(reflect.Append(target, elem.Elem()))
+				continue
+			}
+			key, err := xmlEntryKey(t, target.Type().Key())
+			if err != nil {
+				return err
+			}
+			target.SetMapIndex(key, elem.Elem())
+		}
+	}
+}
+
+func (x *xmlDecoder) nextStart() (xml.StartElement, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+func xmlEntryKey(start xml.StartElement, keyType reflect.Type) (reflect.Value, error) {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "key" {
+			return coerce(attr.Value, keyType)
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("xml: <%s> is missing key attribute", start.Name.Local)
+}
@@ -0,0 +1,83 @@
+package pathways
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type xmlAddress struct {
+	City string `xml:"city"`
+}
+
+type xmlPerson struct {
+	Name    string      `xml:"name,attr"`
+	Tags    []string    `xml:"tag"`
+	Address *xmlAddress `xml:"address"`
+}
+
+func TestXMLEncode(t *testing.T) {
+	tests := []struct {
+		name       string
+		serializer *XMLSerializer
+		value      interface{}
+		expected   string
+	}{
+		{"Struct", &XMLSerializer{}, &xmlPerson{Name: "alice", Tags: []string{"a", "b"}, Address: &xmlAddress{City: "Sydney"}},
+			`<xmlPerson name="alice"><tag>a</tag><tag>b</tag><address><city>Sydney</city></address></xmlPerson>`},
+		{"Map", &XMLSerializer{}, map[string]int{"b": 2, "a": 1},
+			`<map><entry key="a">1</entry><entry key="b">2</entry></map>`},
+		{"ByteMap", &XMLSerializer{}, map[string]uint8{"a": 1},
+			`<map><entry key="a">1</entry></map>`},
+		{"IntKeys", &XMLSerializer{}, map[int]string{10: "x", 2: "y"},
+			`<map><entry key="10">x</entry><entry key="2">y</entry></map>`},
+		{"PointerToMap", &XMLSerializer{}, &map[string]string{"a": "<&>"},
+			`<map><entry key="a">&lt;&amp;&gt;</entry></map>`},
+		{"Slice", &XMLSerializer{}, []int{1, 2},
+			`<list><entry>1</entry><entry>2</entry></list>`},
+		{"Array", &XMLSerializer{}, [2]string{"a", "b"},
+			`<list><entry>a</entry><entry>b</entry></list>`},
+		{"SliceOfStructs", &XMLSerializer{}, []xmlAddress{{City: "a"}},
+			`<list><entry><city>a</city></entry></list>`},
+		{"EmptySlice", &XMLSerializer{}, []int{},
+			`<list></list>`},
+		{"Custom", &XMLSerializer{Envelope: "items", Entry: "item"}, []int{1},
+			`<items><item>1</item></items>`},
+	}
+	for _, test := range tests {
+		w := &bytes.Buffer{}
+		if err := test.serializer.NewEncoder(w).Encode(test.value); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if w.String() != test.expected {
+			t.Errorf("%s: expected %s but got %s", test.name, test.expected, w.String())
+		}
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		value  interface{}
+		target interface{}
+	}{
+		{&xmlPerson{Name: "alice", Tags: []string{"a"}, Address: &xmlAddress{City: "Sydney"}}, &xmlPerson{}},
+		{&map[string]uint8{"a": 1, "b": 2}, &map[string]uint8{}},
+		{&map[int]string{1: "x"}, &map[int]string{}},
+		{&[]xmlAddress{{City: "a"}, {City: "b"}}, &[]xmlAddress{}},
+	}
+	for _, test := range tests {
+		w := &bytes.Buffer{}
+		if err := Serializers.Encode("application/xml", w, test.value); err != nil {
+			t.Errorf("%T: %s", test.value, err)
+			continue
+		}
+		if err := Serializers.Decode("application/xml", w, test.target); err != nil {
+			t.Errorf("%T: %s", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.target, test.value) {
+			t.Errorf("expected %#v but got %#v", test.value, test.target)
+		}
+	}
+}